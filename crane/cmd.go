@@ -5,7 +5,9 @@ import (
 	"github.com/michaelsauter/crane/print"
 	"github.com/spf13/cobra"
 	"os"
+	"strconv"
 	"strings"
+	"time"
 )
 
 type Options struct {
@@ -13,10 +15,31 @@ type Options struct {
 	recreate            bool
 	nocache             bool
 	notrunc             bool
+	orphans             bool
+	format              string
+	status              bool
+	groups              bool
+	explain             bool
 	kill                bool
+	volumes             bool
+	images              bool
+	timeout             int
 	cascadeDependencies string
 	cascadeAffected     string
+	cascadeDepth        int
+	cascadeNonExisting  bool
+	pull                string
 	config              string
+	exclude             string
+	helperImage         string
+	scale               map[string]int
+	rolling             bool
+	wait                int
+	pause               int
+	debounce            int
+	dryRun              bool
+	output              string
+	plan                string
 	target              []string
 }
 
@@ -25,10 +48,30 @@ var options = Options{
 	recreate:            false,
 	nocache:             false,
 	notrunc:             false,
+	orphans:             false,
+	format:              "dot",
+	status:              false,
+	groups:              false,
+	explain:             false,
 	kill:                false,
+	volumes:             false,
+	images:              false,
+	timeout:             -1,
 	cascadeDependencies: "",
 	cascadeAffected:     "",
+	cascadeDepth:        0,
+	cascadeNonExisting:  false,
+	pull:                "",
 	config:              "",
+	exclude:             "",
+	helperImage:         "busybox",
+	scale:               nil,
+	rolling:             false,
+	wait:                60,
+	pause:               0,
+	debounce:            1000,
+	dryRun:              false,
+	output:              "",
 	target:              make([]string, 1), //FIXME: remove pre-allocation when -t/--target is removed
 }
 
@@ -40,20 +83,18 @@ func isVerbose() bool {
 func configCommand(wrapped func(config Config), forceOrder bool) func(cmd *cobra.Command, args []string) {
 	return func(cmd *cobra.Command, args []string) {
 		for _, value := range []string{options.cascadeDependencies, options.cascadeAffected} {
-			if value != "none" && value != "all" && value != "link" && value != "volumesFrom" && value != "net" {
+			if len(value) > 0 && !validCascadingValue(value) {
 				cmd.Printf("Error: invalid cascading value: %v", value)
 				cmd.Usage()
 				panic(StatusError{status: 64})
 			}
 		}
-		if options.target[0] != "" { //FIXME: remove when -t/--target is removed
-			print.Noticef("DEPRECATION: -t/--target is now implicit and will be removed in an upcoming release\n")
-			if len(args) > 0 {
-				options.target = append(args, options.target[0])
-			}
-		} else {
-			options.target = args
+		if !validPullPolicy(options.pull) {
+			cmd.Printf("Error: invalid pull policy: %v", options.pull)
+			cmd.Usage()
+			panic(StatusError{status: 64})
 		}
+		options.target = commandTarget(args)
 
 		config := NewConfig(options, forceOrder)
 		if containers := config.TargetedContainers(); len(containers) == 0 {
@@ -67,7 +108,91 @@ func configCommand(wrapped func(config Config), forceOrder bool) func(cmd *cobra
 	}
 }
 
+// commandTarget returns the target of a command given its arguments,
+// including the deprecated --target and the exclusions of --exclude
+func commandTarget(args []string) []string {
+	target := args
+	if options.target[0] != "" { //FIXME: remove when -t/--target is removed
+		print.Noticef("DEPRECATION: -t/--target is now implicit and will be removed in an upcoming release\n")
+		if len(args) > 0 {
+			target = append(args, options.target[0])
+		}
+	}
+	return withExclusions(target, options.exclude)
+}
+
+// withExclusions appends the comma-separated references
+// passed to --exclude to the target, prefixed with a dash
+func withExclusions(target []string, exclude string) []string {
+	for _, reference := range strings.Split(exclude, ",") {
+		if len(reference) > 0 {
+			target = append(target, "-"+reference)
+		}
+	}
+	return target
+}
+
+// returns a function to be set as a cobra command run, wrapping a command meant to be run
+// for a single container of the config and an archive, as done by the volumes subcommands
+func volumesCommand(wrapped func(container Container, archive string)) func(cmd *cobra.Command, args []string) {
+	return func(cmd *cobra.Command, args []string) {
+		if len(args) < 1 || len(args) > 2 {
+			cmd.Printf("Error: expected a container and optionally an archive")
+			cmd.Usage()
+			panic(StatusError{status: 64})
+		}
+		options.target = args[:1]
+		config := NewConfig(options, true)
+		container, ok := config.ContainerMap()[args[0]]
+		if !ok {
+			panic(StatusError{fmt.Errorf("No container matching `%s`", args[0]), 64})
+		}
+		archive := container.Name() + ".tar"
+		if len(args) == 2 {
+			archive = args[1]
+		}
+		wrapped(container, archive)
+	}
+}
+
+// parseScale parses arguments of the form <container>=<instances>
+func parseScale(args []string) (map[string]int, error) {
+	if len(args) == 0 {
+		return nil, fmt.Errorf("expected at least one <container>=<instances>")
+	}
+	scale := make(map[string]int)
+	for _, arg := range args {
+		parts := strings.SplitN(arg, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid argument %s, expected <container>=<instances>", arg)
+		}
+		instances, err := strconv.Atoi(parts[1])
+		if err != nil || instances < 0 {
+			return nil, fmt.Errorf("invalid number of instances for %s: %s", parts[0], parts[1])
+		}
+		scale[parts[0]] = instances
+	}
+	return scale, nil
+}
+
+// plannedOrphans returns the orphans plan and apply remove,
+// which is none of them as soon as targets are given
+func plannedOrphans(config Config) Containers {
+	if len(options.target) > 0 {
+		return nil
+	}
+	return config.Orphans()
+}
+
 func handleCmd() {
+	err := newCraneCmd().Execute()
+	if err != nil {
+		panic(StatusError{status: 64})
+	}
+}
+
+// newCraneCmd returns the root command, along with its subcommands
+func newCraneCmd() *cobra.Command {
 
 	var cmdLift = &cobra.Command{
 		Use:   "lift",
@@ -75,7 +200,7 @@ func handleCmd() {
 		Long: `
 lift will provision missing images and run all targeted containers.`,
 		Run: configCommand(func(config Config) {
-			config.TargetedContainers().lift(options.recreate, options.nocache)
+			config.TargetedContainers().lift(options.recreate, options.nocache, options.timeout)
 		}, false),
 	}
 
@@ -84,7 +209,8 @@ lift will provision missing images and run all targeted containers.`,
 		Short: "Build or pull images",
 		Long: `
 provision will use specified Dockerfiles to build all targeted images.
-If no Dockerfile is given, it will pull the image(s) from the given registry.`,
+If no Dockerfile is given, it will pull the image(s) from the given registry,
+according to the pull policy of the container(s).`,
 		Run: configCommand(func(config Config) {
 			config.TargetedContainers().provision(options.nocache)
 		}, true),
@@ -95,16 +221,29 @@ If no Dockerfile is given, it will pull the image(s) from the given registry.`,
 		Short: "Run the containers",
 		Long:  `run will call docker run for all targeted containers.`,
 		Run: configCommand(func(config Config) {
-			config.TargetedContainers().run(options.recreate)
+			config.TargetedContainers().run(options.recreate, options.timeout)
 		}, false),
 	}
 
 	var cmdRm = &cobra.Command{
 		Use:   "rm",
 		Short: "Remove the containers",
-		Long:  `rm will call docker rm for all targeted containers.`,
+		Long: `
+rm will call docker rm for all targeted containers, including the
+instances of scaled containers exceeding their number of instances.`,
 		Run: configCommand(func(config Config) {
-			config.TargetedContainers().reversed().rm(options.kill)
+			append(config.Surplus(), config.TargetedContainers().reversed()...).rm(options.kill, options.timeout)
+		}, true),
+	}
+
+	var cmdDown = &cobra.Command{
+		Use:   "down",
+		Short: "Stop and remove the containers",
+		Long: `
+down will stop and remove all targeted containers, in reverse dependency order.
+Optionally, their volumes and the images built from Dockerfiles are removed too.`,
+		Run: configCommand(func(config Config) {
+			append(config.Surplus(), config.TargetedContainers().reversed()...).down(options.kill, options.volumes, options.images, options.timeout)
 		}, true),
 	}
 
@@ -113,7 +252,7 @@ If no Dockerfile is given, it will pull the image(s) from the given registry.`,
 		Short: "Kill the containers",
 		Long:  `kill will call docker kill for all targeted containers.`,
 		Run: configCommand(func(config Config) {
-			config.TargetedContainers().reversed().kill()
+			append(config.Surplus(), config.TargetedContainers().reversed()...).kill()
 		}, true),
 	}
 
@@ -129,12 +268,27 @@ If no Dockerfile is given, it will pull the image(s) from the given registry.`,
 	var cmdStop = &cobra.Command{
 		Use:   "stop",
 		Short: "Stop the containers",
-		Long:  `stop will call docker stop for all targeted containers.`,
+		Long: `
+stop will call docker stop for all targeted containers, including the
+instances of scaled containers exceeding their number of instances.`,
 		Run: configCommand(func(config Config) {
-			config.TargetedContainers().reversed().stop()
+			append(config.Surplus(), config.TargetedContainers().reversed()...).stop(options.timeout)
 		}, true),
 	}
 
+	var cmdRestart = &cobra.Command{
+		Use:   "restart",
+		Short: "Restart the containers",
+		Long: `
+restart will stop all targeted containers in reverse dependency order,
+and then start them again in dependency order. As links break when a
+linked container is restarted, use --cascade-affected=link to restart
+the containers linking to them as well.`,
+		Run: configCommand(func(config Config) {
+			config.TargetedContainers().restart(options.timeout)
+		}, false),
+	}
+
 	var cmdPause = &cobra.Command{
 		Use:   "pause",
 		Short: "Pause the containers",
@@ -165,25 +319,271 @@ If no Dockerfile is given, it will pull the image(s) from the given registry.`,
 	var cmdStatus = &cobra.Command{
 		Use:   "status",
 		Short: "Displays status of containers",
-		Long:  `Displays the current status of all targeted containers.`,
+		Long: `Displays the current status of all targeted containers, followed by
+the named volumes they use. With --orphans, displays the containers created
+for this config which are not declared in it anymore instead.`,
+		Run: configCommand(func(config Config) {
+			if options.orphans {
+				config.Orphans().status(options.notrunc)
+			} else {
+				containers := config.TargetedContainers()
+				containers.status(options.notrunc)
+				config.VolumeMap().status(containers.namedVolumes())
+			}
+		}, true),
+	}
+
+	var cmdPrune = &cobra.Command{
+		Use:   "prune",
+		Short: "Remove orphaned containers",
+		Long: `prune will kill and remove the containers created for this config
+which are not declared in it anymore.`,
 		Run: configCommand(func(config Config) {
-			config.TargetedContainers().status(options.notrunc)
+			config.Orphans().prune()
 		}, true),
 	}
 
 	var cmdGraph = &cobra.Command{
 		Use:   "graph",
-		Short: "Dumps the dependency graph as a DOT file",
-		Long:  `Generate a DOT file representing the dependency graph. Bold nodes represent the
-containers declared in the config (as opposed to non-bold ones that are referenced
-in the config, but not defined). Targeted containers are highlighted with color
-borders. Solid edges represent links, dashed edges volumesFrom, and dotted edges
-net=container relations.`,
+		Short: "Dumps the dependency graph",
+		Long: `Dumps the dependency graph in the format given by --format:
+
+dot: a DOT file. Bold nodes represent the containers declared in the config
+(as opposed to non-bold ones that are referenced in the config, but not
+defined). Targeted containers are highlighted with color borders. Solid edges
+represent links, dashed edges volumesFrom, and dotted edges net=container
+relations. With --status, nodes are filled according to the state of the
+containers (green: running, yellow: stopped, grey: missing), and containers
+created from an outdated image are labelled as such. With --groups, groups
+are rendered as clusters (a container in several groups only appears in the
+first one by name).
+json: the containers (declared or not, targeted or not) and the edges between
+them, with their kind (link, volumesFrom or net).
+mermaid: a Mermaid flowchart, using the same conventions as the DOT output,
+except for net=container relations being thick edges.
+tree: an ASCII tree of the dependencies, starting from the containers no
+other container depends on. Targeted containers are marked with a star.`,
+		Run: func(cmd *cobra.Command, args []string) {
+			if options.format != "dot" && options.format != "json" && options.format != "mermaid" && options.format != "tree" {
+				cmd.Printf("Error: invalid format: %v", options.format)
+				cmd.Usage()
+				panic(StatusError{status: 64})
+			}
+			configCommand(func(config Config) {
+				graph := config.DependencyGraph()
+				switch options.format {
+				case "json":
+					graph.JSON(os.Stdout, config.TargetedContainers())
+				case "mermaid":
+					graph.Mermaid(os.Stdout, config.TargetedContainers())
+				case "tree":
+					graph.Tree(os.Stdout, config.TargetedContainers())
+				default:
+					dotOptions := DOTOptions{}
+					if options.status {
+						dotOptions.States = containerStates(config.ContainerMap())
+					}
+					if options.groups {
+						dotOptions.Groups = config.Groups()
+					}
+					graph.DOT(os.Stdout, config.TargetedContainers(), dotOptions)
+				}
+			}, true)(cmd, args)
+		},
+	}
+
+	var cmdTargets = &cobra.Command{
+		Use:   "targets",
+		Short: "Displays the targeted containers",
+		Long: `Displays the targeted containers in execution order. With --explain, the
+reason each container was targeted for is displayed as well: explicitly, via
+a group, as a dependency of another container (--cascade-dependencies) or
+as affected by another container (--cascade-affected).`,
+		Run: configCommand(func(config Config) {
+			config.TargetedContainers().targets(config.TargetReasons(), options.explain)
+		}, true),
+	}
+
+	var cmdUpdate = &cobra.Command{
+		Use:   "update",
+		Short: "Update the images and recreate the containers",
+		Long: `
+update will provision the images and recreate all targeted containers. With
+--rolling, each container is replaced one after the other in dependency order:
+the new container is run under a temporary name and, once it is ready, takes
+over the name of the old one, which is then removed.`,
+		Run: configCommand(func(config Config) {
+			config.TargetedContainers().update(config, options.rolling, options.nocache, options.timeout, options.wait, options.pause)
+		}, false),
+	}
+
+	var cmdDiff = &cobra.Command{
+		Use:   "diff",
+		Short: "Compare the config with the live containers",
+		Long: `
+diff will compare the configured parameters (image, env, ports, volumes, links
+and cmd) of all targeted containers with the ones of the live containers. The
+configured values are prefixed with - and the actual ones with +.`,
+		Run: configCommand(func(config Config) {
+			config.TargetedContainers().diff()
+		}, true),
+	}
+
+	var cmdPlan = &cobra.Command{
+		Use:   "plan",
+		Short: "Display the actions needed to bring the containers in line with the config",
+		Long: `
+plan will display the actions apply would execute for all targeted containers:
+building or pulling images, creating, starting or recreating containers, and
+removing the containers no longer declared (unless targets are given). With
+--output, the plan is saved as JSON, to be reviewed and executed later with
+apply.`,
+		Run: configCommand(func(config Config) {
+			plan := newPlan(config, config.TargetedContainers(), plannedOrphans(config))
+			plan.display(os.Stdout)
+			if len(options.output) > 0 {
+				plan.save(options.output)
+				print.Noticef("Plan saved to %s.\n", options.output)
+			}
+		}, false),
+	}
+
+	var cmdApply = &cobra.Command{
+		Use:   "apply",
+		Short: "Bring the containers in line with the config",
+		Long: `
+apply compares the config with the containers: images are provisioned if
+needed, targeted containers which do not exist are created, the ones whose
+definition changed since they were run are recreated, stopped ones are
+started, and the containers no longer declared are removed (unless targets
+are given). The plan is displayed before being executed.
+Given a plan saved by plan --output with --plan, apply executes exactly
+that plan, and refuses to do so if the containers, their images or their
+definitions changed in between.`,
+		Run: func(cmd *cobra.Command, args []string) {
+			if len(options.plan) > 0 {
+				if len(args) > 0 {
+					panic(StatusError{fmt.Errorf("Targets cannot be given along with a saved plan"), 64})
+				}
+				plan := readPlan(options.plan)
+				options.target = []string{}
+				config := NewConfig(options, true)
+				if err := plan.resolve(config); err != nil {
+					panic(StatusError{err, 1})
+				}
+				plan.display(os.Stdout)
+				if !options.dryRun {
+					plan.execute(options.timeout)
+				}
+				return
+			}
+			configCommand(func(config Config) {
+				plan := newPlan(config, config.TargetedContainers(), plannedOrphans(config))
+				plan.display(os.Stdout)
+				if !options.dryRun {
+					plan.execute(options.timeout)
+				}
+			}, false)(cmd, args)
+		},
+	}
+
+	var cmdWatch = &cobra.Command{
+		Use:   "watch",
+		Short: "Rebuild and recreate the containers on changes",
+		Long: `
+watch will scan the build context and the watch paths of all targeted
+containers. When files change, the image is rebuilt and the container is
+recreated, along with the existing containers depending on it.`,
 		Run: configCommand(func(config Config) {
-				config.DependencyGraph().DOT(os.Stdout, config.TargetedContainers())
+			watch(config, time.Duration(options.debounce)*time.Millisecond, options.timeout)
 		}, true),
 	}
 
+	var cmdScale = &cobra.Command{
+		Use:   "scale <container>=<instances> ...",
+		Short: "Set the number of instances of containers",
+		Long: `
+scale runs the given number of instances of the containers, overriding the
+configured instances, and removes the instances exceeding that number.`,
+		Run: func(cmd *cobra.Command, args []string) {
+			scale, err := parseScale(args)
+			if err != nil {
+				cmd.Printf("Error: %s", err)
+				cmd.Usage()
+				panic(StatusError{status: 64})
+			}
+			options.scale = scale
+			options.target = []string{}
+			for name := range scale {
+				options.target = append(options.target, name)
+			}
+			config := NewConfig(options, false)
+			config.TargetedContainers().lift(false, false, options.timeout)
+			config.Surplus().rm(true, options.timeout)
+		},
+	}
+
+	var cmdDo = &cobra.Command{
+		Use:   "do <task> [-- args]",
+		Short: "Run a task in a throwaway container",
+		Long: `
+do lifts the dependencies of the given task, then runs the task in a new
+container with a unique name, which is removed afterwards. Arguments after
+the task are appended to its command, and its exit status is returned.`,
+		Run: func(cmd *cobra.Command, args []string) {
+			if len(args) < 1 {
+				cmd.Printf("Error: expected a task")
+				cmd.Usage()
+				panic(StatusError{status: 64})
+			}
+			if len(options.cascadeDependencies) == 0 {
+				options.cascadeDependencies = "all"
+			}
+			if !validCascadingValue(options.cascadeDependencies) {
+				cmd.Printf("Error: invalid cascading value: %v", options.cascadeDependencies)
+				cmd.Usage()
+				panic(StatusError{status: 64})
+			}
+			options.target = args[:1]
+			options.cascadeAffected = "none"
+			config := NewConfig(options, false)
+			if task, ok := config.ContainerMap()[args[0]]; !ok || task.Kind() != KindTask {
+				panic(StatusError{fmt.Errorf("No task named `%s`", args[0]), 64})
+			}
+			config.TargetedContainers().do(args[0], args[1:])
+		},
+	}
+
+	var cmdVolumes = &cobra.Command{
+		Use:   "volumes",
+		Short: "Back up or restore the volumes of a container",
+		Long:  `volumes has subcommands to back up and restore the volumes of a container.`,
+	}
+
+	var cmdVolumesBackup = &cobra.Command{
+		Use:   "backup <container> [archive]",
+		Short: "Back up the volumes of a container",
+		Long: `
+backup archives the volumes of the given container, including the ones it gets
+from data containers via volumes-from, into a tar archive (<container>.tar by
+default), using a throwaway container.`,
+		Run: volumesCommand(func(container Container, archive string) {
+			container.BackupVolumes(archive, options.helperImage)
+		}),
+	}
+
+	var cmdVolumesRestore = &cobra.Command{
+		Use:   "restore <container> [archive]",
+		Short: "Restore the volumes of a container",
+		Long: `
+restore extracts a tar archive created by backup (<container>.tar by default)
+into the volumes of the given container, using a throwaway container.
+The container must not be running.`,
+		Run: volumesCommand(func(container Container, archive string) {
+			container.RestoreVolumes(archive, options.helperImage)
+		}),
+	}
+
 	var cmdVersion = &cobra.Command{
 		Use:   "version",
 		Short: "Display version",
@@ -204,26 +604,74 @@ See the corresponding docker commands for more information.`,
 
 	craneCmd.PersistentFlags().BoolVarP(&options.verbose, "verbose", "v", false, "Verbose output")
 	craneCmd.PersistentFlags().StringVarP(&options.config, "config", "c", "", "Config file to read from")
+	craneCmd.PersistentFlags().StringVarP(&options.exclude, "exclude", "", "", "Comma-separated group(s) or container(s) to exclude from the targeted ones")
 	craneCmd.PersistentFlags().StringVarP(&options.target[0], "target", "t", "", "Group or container to execute the command for [DEPRECATED, NOW IMPLICIT]")
 	cascadingValuesSuffix := `
+					"none": do not cascade (default, unless set by the targeted groups)
 					"all": follow any kind of dependency
 					"link": follow --link dependencies only
 					"volumesFrom": follow --volumesFrom dependencies only
 					"net": follow --net dependencies only
+					several kinds can be comma-separated, e.g. "link,net"
 	`
-	craneCmd.PersistentFlags().StringVarP(&options.cascadeDependencies, "cascade-dependencies", "d", "none", "Also apply the command for the containers that (any of) the explicitly targeted one(s) depend on"+cascadingValuesSuffix)
-	craneCmd.PersistentFlags().StringVarP(&options.cascadeAffected, "cascade-affected", "a", "none", "Also apply the command for the existing containers depending on (any of) the explicitly targeted one(s)"+cascadingValuesSuffix)
+	craneCmd.PersistentFlags().StringVarP(&options.cascadeDependencies, "cascade-dependencies", "d", "", "Also apply the command for the containers that (any of) the explicitly targeted one(s) depend on"+cascadingValuesSuffix)
+	craneCmd.PersistentFlags().StringVarP(&options.cascadeAffected, "cascade-affected", "a", "", "Also apply the command for the existing containers depending on (any of) the explicitly targeted one(s)"+cascadingValuesSuffix)
+	craneCmd.PersistentFlags().IntVarP(&options.cascadeDepth, "cascade-depth", "", 0, "Maximum number of cascading steps (0 for unlimited)")
+	craneCmd.PersistentFlags().BoolVarP(&options.cascadeNonExisting, "cascade-nonexisting", "", false, "Also cascade to affected containers which do not exist")
 
 	cmdLift.Flags().BoolVarP(&options.recreate, "recreate", "r", false, "Recreate containers (kill and remove containers if they exist, force-provision images, run containers)")
 	cmdLift.Flags().BoolVarP(&options.nocache, "no-cache", "n", false, "Build the image without any cache")
 
+	cmdLift.Flags().IntVarP(&options.timeout, "timeout", "", -1, "Seconds to wait for containers to stop before killing them (overrides the configured stop timeouts)")
+	cmdLift.Flags().StringVarP(&options.pull, "pull", "", "", "Override the pull policy of all containers (always, missing or never)")
+
 	cmdProvision.Flags().BoolVarP(&options.nocache, "no-cache", "n", false, "Build the image without any cache")
+	cmdProvision.Flags().StringVarP(&options.pull, "pull", "", "", "Override the pull policy of all containers (always, missing or never)")
 
 	cmdRun.Flags().BoolVarP(&options.recreate, "recreate", "r", false, "Recreate containers (kill and remove containers first)")
+	cmdRun.Flags().IntVarP(&options.timeout, "timeout", "", -1, "Seconds to wait for containers to stop before killing them (overrides the configured stop timeouts)")
+	cmdRun.Flags().StringVarP(&options.pull, "pull", "", "", "Override the pull policy of all containers (always, missing or never)")
 
 	cmdRm.Flags().BoolVarP(&options.kill, "kill", "k", false, "Kill containers if they are running first")
+	cmdRm.Flags().IntVarP(&options.timeout, "timeout", "", -1, "Seconds to wait for containers to stop before killing them (overrides the configured stop timeouts)")
+
+	cmdStop.Flags().IntVarP(&options.timeout, "timeout", "", -1, "Seconds to wait for containers to stop before killing them (overrides the configured stop timeouts)")
+
+	cmdRestart.Flags().IntVarP(&options.timeout, "timeout", "", -1, "Seconds to wait for containers to stop before killing them (overrides the configured stop timeouts)")
+
+	cmdDown.Flags().BoolVarP(&options.kill, "kill", "k", false, "Kill containers instead of stopping them")
+	cmdDown.Flags().BoolVarP(&options.volumes, "volumes", "", false, "Remove the volumes of the containers, including the named ones")
+	cmdDown.Flags().BoolVarP(&options.images, "images", "", false, "Remove the images built from Dockerfiles")
+	cmdDown.Flags().IntVarP(&options.timeout, "timeout", "", -1, "Seconds to wait for containers to stop before killing them (overrides the configured stop timeouts)")
+
+	cmdUpdate.Flags().BoolVarP(&options.rolling, "rolling", "", false, "Replace the containers one after the other without downtime")
+	cmdUpdate.Flags().BoolVarP(&options.nocache, "no-cache", "n", false, "Build the image without any cache")
+	cmdUpdate.Flags().IntVarP(&options.timeout, "timeout", "", -1, "Seconds to wait for containers to stop before killing them (overrides the configured stop timeouts)")
+	cmdUpdate.Flags().IntVarP(&options.wait, "wait", "", 60, "Seconds to wait for a new container to be ready (running and healthy)")
+	cmdUpdate.Flags().IntVarP(&options.pause, "pause", "", 0, "Seconds to pause between containers")
+
+	cmdPlan.Flags().StringVarP(&options.output, "output", "o", "", "File to save the plan to as JSON")
+
+	cmdApply.Flags().StringVarP(&options.plan, "plan", "", "", "Saved plan to execute instead of planning")
+	cmdApply.Flags().BoolVarP(&options.dryRun, "dry-run", "", false, "Only display the plan")
+	cmdApply.Flags().IntVarP(&options.timeout, "timeout", "", -1, "Seconds to wait for containers to stop before killing them (overrides the configured stop timeouts)")
+
+	cmdWatch.Flags().IntVarP(&options.debounce, "debounce", "", 1000, "Milliseconds without further changes to wait for before rebuilding")
+	cmdWatch.Flags().IntVarP(&options.timeout, "timeout", "", -1, "Seconds to wait for containers to stop before killing them (overrides the configured stop timeouts)")
+
+	cmdScale.Flags().IntVarP(&options.timeout, "timeout", "", -1, "Seconds to wait for containers to stop before killing them (overrides the configured stop timeouts)")
 
 	cmdStatus.Flags().BoolVarP(&options.notrunc, "no-trunc", "", false, "Don't truncate output")
+	cmdStatus.Flags().BoolVarP(&options.orphans, "orphans", "", false, "Display orphaned containers instead")
+
+	cmdGraph.Flags().StringVarP(&options.format, "format", "f", "dot", "Output format (dot, json, mermaid or tree)")
+	cmdGraph.Flags().BoolVarP(&options.status, "status", "", false, "Render the state of the containers (DOT only)")
+	cmdGraph.Flags().BoolVarP(&options.groups, "groups", "", false, "Render groups as clusters (DOT only)")
+
+	cmdVolumes.PersistentFlags().StringVarP(&options.helperImage, "image", "", "busybox", "Image of the throwaway container (must provide tar)")
+	cmdVolumes.AddCommand(cmdVolumesBackup, cmdVolumesRestore)
+
+	cmdTargets.Flags().BoolVarP(&options.explain, "explain", "e", false, "Explain why each container is targeted")
 
 	// default usage template with target arguments & description
 	craneCmd.SetUsageTemplate(`{{ $cmd := . }}
@@ -241,6 +689,11 @@ Explicit targeting:
   passed as  argument(s), the command will only be applied to containers
   matching these references. Note however that providing cascading flags
   might extend the set of targeted containers.
+  References can be comma-separated, and can be glob patterns (web-*),
+  regular expressions (re:^svc-) or ` + "`" + `all` + "`" + `. References prefixed with
+  a dash (all,-mysql), or passed to --exclude, are excluded. A reference
+  starting with a dash has to follow -- (-- -mysql), as it is taken for a
+  flag otherwise.
 
 {{ if .HasFlags}}Available Flags:
 {{.Flags.FlagUsages}}{{end}}{{if .HasParent}}{{if and (gt .Commands 0) (gt .Parent.Commands 1) }}
@@ -250,9 +703,6 @@ Additional help topics: {{if gt .Commands 0 }}{{range .Commands}}{{if not .Runna
 Use "{{.Root.Name}} help [command]" for more information about that command.
 `)
 
-	craneCmd.AddCommand(cmdLift, cmdProvision, cmdRun, cmdRm, cmdKill, cmdStart, cmdStop, cmdPause, cmdUnpause, cmdPush, cmdStatus, cmdGraph, cmdVersion)
-	err := craneCmd.Execute()
-	if err != nil {
-		panic(StatusError{status: 64})
-	}
+	craneCmd.AddCommand(cmdLift, cmdProvision, cmdRun, cmdRm, cmdDown, cmdKill, cmdStart, cmdStop, cmdRestart, cmdPause, cmdUnpause, cmdPush, cmdStatus, cmdPrune, cmdUpdate, cmdDiff, cmdPlan, cmdApply, cmdWatch, cmdGraph, cmdTargets, cmdScale, cmdDo, cmdVolumes, cmdVersion)
+	return craneCmd
 }
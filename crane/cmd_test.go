@@ -0,0 +1,61 @@
+package crane
+
+import (
+	"github.com/spf13/cobra"
+	"io/ioutil"
+	"reflect"
+	"testing"
+)
+
+func TestExclusionArguments(t *testing.T) {
+	containerMap := NewStubbedContainerMap(true,
+		&container{RawName: "web"},
+		&container{RawName: "mysql"},
+		&container{RawName: "memcached"},
+	)
+	c := &config{containerMap: containerMap}
+	c.dependencyGraph = c.DependencyGraph()
+	options.target = make([]string, 1)
+	craneCmd := newCraneCmd()
+	craneCmd.SetOutput(ioutil.Discard)
+	// the real commands and flags, only with runs
+	// stopping short of reading the config
+	var target []string
+	for _, cmd := range craneCmd.Commands() {
+		if cmd.Name() == "stop" || cmd.Name() == "lift" {
+			cmd.Run = func(cmd *cobra.Command, args []string) {
+				target = commandTarget(args)
+			}
+		}
+	}
+
+	examples := []struct {
+		args     []string
+		expected Target
+	}{
+		{args: []string{"stop", "--", "-mysql"}, expected: Target{"memcached", "web"}},
+		{args: []string{"stop", "all", "--", "-mysql"}, expected: Target{"memcached", "web"}},
+		{args: []string{"stop", "all,-mysql"}, expected: Target{"memcached", "web"}},
+		{args: []string{"stop", "--exclude", "mysql,memcached"}, expected: Target{"web"}},
+		{args: []string{"lift", "web", "--exclude=web"}, expected: Target{}},
+		{args: []string{"--exclude=mysql", "lift"}, expected: Target{"memcached", "web"}},
+	}
+	for _, example := range examples {
+		target, options.exclude = nil, ""
+		craneCmd.SetArgs(example.args)
+		if err := craneCmd.Execute(); err != nil {
+			t.Errorf("Arguments %v should have been accepted, got %s", example.args, err)
+			continue
+		}
+		c.determineTarget(target, "none", "none")
+		if !reflect.DeepEqual(c.target, example.expected) {
+			t.Errorf("Target for %v should have been %v, got %v", example.args, example.expected, c.target)
+		}
+	}
+
+	// without --, a reference starting with a dash is taken for flags
+	craneCmd.SetArgs([]string{"stop", "-mysql"})
+	if err := craneCmd.Execute(); err == nil {
+		t.Errorf("Reference starting with a dash should have been parsed as flags")
+	}
+}
@@ -8,23 +8,48 @@ import (
 	"gopkg.in/v1/yaml"
 	"io/ioutil"
 	"os"
+	"path"
 	"path/filepath"
+	"regexp"
 	"sort"
+	"strings"
 )
 
 type Config interface {
 	TargetedContainers() Containers
 	DependencyGraph() DependencyGraph
+	Orphans() Containers
+	Surplus() Containers
+	ContainerMap() ContainerMap
+	VolumeMap() VolumeMap
+	Groups() map[string][]string
+	TargetReasons() map[string]string
+	Path() string
 }
 
 type config struct {
-	RawContainerMap containerMap        `json:"containers" yaml:"containers"`
-	RawGroups       map[string][]string `json:"groups" yaml:"groups"`
+	RawContainerMap containerMap           `json:"containers" yaml:"containers"`
+	RawGroups       map[string]interface{} `json:"groups" yaml:"groups"`
+	RawPull         string                 `json:"pull" yaml:"pull"`
+	RawNetworks     map[string]*network    `json:"networks" yaml:"networks"`
+	RawVolumes      map[string]*volume     `json:"volumes" yaml:"volumes"`
+	LinksAsAliases  bool                   `json:"links-as-aliases" yaml:"links-as-aliases"`
+	path            string
+	networkMap      NetworkMap
+	volumeMap       VolumeMap
 	containerMap    ContainerMap
 	dependencyGraph DependencyGraph
 	target          Target
+	reasons         map[string]string
 	order           []string
 	groups          map[string][]string
+	groupReferences map[string][]string
+	groupSettings   map[string]groupSettings
+	instances       map[string]int
+	// maximum number of cascading steps, 0 meaning unlimited
+	cascadeDepth int
+	// whether to cascade to affected containers which do not exist
+	cascadeNonExisting bool
 }
 
 // ContainerMap maps the container name
@@ -122,13 +147,23 @@ func NewConfig(options Options, forceOrder bool) Config {
 	for _, f := range configFiles(options) {
 		if _, err := os.Stat(f); err == nil {
 			config = readConfig(f)
+			config.path, _ = filepath.Abs(f)
 			break
 		}
 	}
 	if config == nil {
 		panic(StatusError{fmt.Errorf("No configuration found %v", configFiles(options)), 78})
 	}
+	config.setInstances(options.scale)
 	config.expandEnv()
+	config.setPullPolicies(options.pull)
+	config.setKinds()
+	config.validateHooks()
+	config.setLabels()
+	config.setNetworks()
+	config.setVolumes()
+	config.cascadeDepth = options.cascadeDepth
+	config.cascadeNonExisting = options.cascadeNonExisting
 	config.dependencyGraph = config.DependencyGraph()
 	config.determineTarget(options.target, options.cascadeDependencies, options.cascadeAffected)
 
@@ -149,6 +184,43 @@ func (c *config) TargetedContainers() Containers {
 	return containers
 }
 
+// ContainerMap returns all containers of the config
+func (c *config) ContainerMap() ContainerMap {
+	return c.containerMap
+}
+
+// VolumeMap returns the named volumes of the config
+func (c *config) VolumeMap() VolumeMap {
+	return c.volumeMap
+}
+
+// Path returns the absolute path of the config file
+func (c *config) Path() string {
+	return c.path
+}
+
+// Groups returns the groups of the config
+func (c *config) Groups() map[string][]string {
+	return c.groups
+}
+
+// TargetReasons maps the targeted containers
+// to the reason they were targeted for
+func (c *config) TargetReasons() map[string]string {
+	return c.reasons
+}
+
+// explain records the reason why the given container was
+// targeted, unless it was already targeted for another one
+func (c *config) explain(name string, reason string) {
+	if c.reasons == nil {
+		c.reasons = make(map[string]string)
+	}
+	if _, ok := c.reasons[name]; !ok {
+		c.reasons[name] = reason
+	}
+}
+
 // expandEnv creates a new container map
 // with expanded names and sets the RawName of each
 // container to the map key.
@@ -161,14 +233,232 @@ func (c *config) expandEnv() {
 		c.containerMap[container.Name()] = container
 	}
 	// Groups
-	c.groups = make(map[string][]string)
-	for groupRawName, rawNames := range c.RawGroups {
-		for _, rawName := range rawNames {
-			c.groups[groupRawName] = append(c.groups[groupRawName], os.ExpandEnv(rawName))
+	references := make(map[string][]string)
+	c.groupSettings = make(map[string]groupSettings)
+	for groupRawName, rawGroup := range c.RawGroups {
+		references[groupRawName], c.groupSettings[groupRawName] = parseGroup(groupRawName, rawGroup)
+	}
+	c.groups = flattenGroups(references)
+	c.groupReferences = references
+	c.applyGroupEnv()
+}
+
+// applyGroupEnv prepends the env of the groups to the env of their
+// containers, outer groups first, so that the env of the inner groups
+// and then the one of the containers take precedence
+func (c *config) applyGroupEnv() {
+	depths := groupDepths(c.groupReferences)
+	names := []string{}
+	for name := range c.groups {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	groupNames := []string{}
+	for depth := 0; len(groupNames) < len(names); depth++ {
+		for _, name := range names {
+			if depths[name] == depth {
+				groupNames = append(groupNames, name)
+			}
+		}
+	}
+	for _, container := range c.RawContainerMap {
+		env := []string{}
+		for _, groupName := range groupNames {
+			if Target(c.groups[groupName]).includes(container.Name()) {
+				env = append(env, c.groupSettings[groupName].Env...)
+			}
+		}
+		if len(env) > 0 {
+			container.RunParams.RawEnv = append(env, container.RunParams.RawEnv...)
+		}
+	}
+}
+
+// setPullPolicies makes the containers without a pull policy
+// inherit the global one. If override is not empty, it is used
+// for all containers instead.
+func (c *config) setPullPolicies(override string) {
+	for _, container := range c.RawContainerMap {
+		if len(override) > 0 {
+			container.RawPull = override
+		} else if len(container.RawPull) == 0 {
+			container.RawPull = c.RawPull
+		}
+		if !validPullPolicy(container.PullPolicy()) {
+			panic(StatusError{fmt.Errorf("Invalid pull policy `%s` for container %s", container.PullPolicy(), container.Name()), 78})
+		}
+	}
+}
+
+// setKinds validates the kind of all containers. Tasks
+// are always run in the foreground and removed afterwards.
+func (c *config) setKinds() {
+	for _, container := range c.RawContainerMap {
+		switch container.Kind() {
+		case KindService:
+		case KindTask:
+			container.RunParams.Rm = true
+			container.RunParams.Detach = false
+		default:
+			panic(StatusError{fmt.Errorf("Invalid kind `%s` for container %s", container.Kind(), container.Name()), 78})
+		}
+	}
+}
+
+// validateHooks checks the hooks of all containers, and
+// sets the directory their host commands are run from
+func (c *config) validateHooks() {
+	for _, container := range c.RawContainerMap {
+		container.Hooks.validate(container.Name(), container.RunParams.Detach)
+		if len(c.path) > 0 {
+			container.hookDir = filepath.Dir(c.path)
+		}
+	}
+}
+
+// setLabels sets the labels identifying the project
+// and the config on all containers
+func (c *config) setLabels() {
+	for _, container := range c.RawContainerMap {
+		container.labels = []string{
+			projectLabel + "=" + c.project(),
+			configLabel + "=" + c.path,
 		}
 	}
 }
 
+// setNetworks makes the declared networks available to the
+// containers. If links are translated into network aliases,
+// all containers join a default network, and linked containers
+// get the link aliases in that network.
+func (c *config) setNetworks() {
+	c.networkMap = make(NetworkMap)
+	for rawName, n := range c.RawNetworks {
+		if n == nil {
+			n = &network{}
+		}
+		n.RawName = rawName
+		n.labels = []string{configLabel + "=" + c.path}
+		c.networkMap[n.Name()] = n
+	}
+	defaultNetwork := ""
+	if c.LinksAsAliases {
+		defaultNetwork = c.project() + "_default"
+		if _, ok := c.networkMap[defaultNetwork]; !ok {
+			c.networkMap[defaultNetwork] = &network{resource{RawName: defaultNetwork, labels: []string{configLabel + "=" + c.path}}}
+		}
+	}
+	rawContainers := make(map[string]*container)
+	for _, container := range c.RawContainerMap {
+		if container.RunParams.Net() != "bridge" && (len(container.RunParams.Networks()) > 0 || c.LinksAsAliases) {
+			panic(StatusError{fmt.Errorf("Container %s cannot combine `net` with networks (or links-as-aliases)", container.Name()), 78})
+		}
+		container.networkMap = c.networkMap
+		container.sharedNetwork = defaultNetwork
+		container.linkAliases = nil
+		rawContainers[container.Name()] = container
+	}
+	if c.LinksAsAliases {
+		for _, container := range c.RawContainerMap {
+			for _, link := range container.RunParams.Link() {
+				linkParts := strings.Split(link, ":")
+				alias := linkParts[len(linkParts)-1]
+				if linked, ok := rawContainers[linkParts[0]]; ok && !Target(linked.linkAliases).includes(alias) {
+					linked.linkAliases = append(linked.linkAliases, alias)
+				}
+			}
+		}
+	}
+}
+
+// setVolumes makes the declared named volumes
+// available to the containers
+func (c *config) setVolumes() {
+	c.volumeMap = make(VolumeMap)
+	for rawName, v := range c.RawVolumes {
+		if v == nil {
+			v = &volume{}
+		}
+		v.RawName = rawName
+		v.labels = []string{configLabel + "=" + c.path}
+		c.volumeMap[v.Name()] = v
+	}
+	for _, container := range c.RawContainerMap {
+		container.volumeMap = c.volumeMap
+	}
+}
+
+// project returns the name of the project, which is
+// the name of the directory containing the config
+func (c *config) project() string {
+	return filepath.Base(filepath.Dir(c.path))
+}
+
+// Orphans returns the containers created by crane for this
+// config, but which are not declared in it anymore. Running
+// tasks and the containers of unfinished updates are left out.
+func (c *config) Orphans() Containers {
+	var orphans Containers
+	args := []string{"ps", "--all", "--quiet", "--no-trunc", "--filter", "label=" + configLabel + "=" + c.path}
+	output, err := commandOutput("docker", args)
+	if err != nil || len(output) == 0 {
+		return orphans
+	}
+	for _, id := range strings.Fields(output) {
+		fields := strings.Split(inspectString(id, "{{.Name}}\t{{.Config.Image}}\t{{index .Config.Labels \""+kindLabel+"\"}}"), "\t")
+		if len(fields) != 3 {
+			continue
+		}
+		name := strings.TrimPrefix(fields[0], "/")
+		if c.orphaned(name, fields[2]) {
+			orphans = append(orphans, &container{RawName: name, RawImage: fields[1]})
+		}
+	}
+	return orphans
+}
+
+// orphaned checks whether the container of the given name and kind
+// label is an orphan: it is neither declared, nor the throwaway
+// container of a task, nor a container an update of a declared
+// container runs next to it (<name>-next and <name>-old)
+func (c *config) orphaned(name string, kind string) bool {
+	if _, declared := c.containerMap[name]; declared || kind == KindTask {
+		return false
+	}
+	for _, suffix := range []string{"-next", "-old"} {
+		if _, updating := c.containerMap[strings.TrimSuffix(name, suffix)]; updating && strings.HasSuffix(name, suffix) {
+			return false
+		}
+	}
+	return true
+}
+
+// validCascadingValue checks whether the given value can be used
+// for cascading: either none, or one or several comma-separated kinds
+func validCascadingValue(value string) bool {
+	if value == "none" {
+		return true
+	}
+	for _, kind := range strings.Split(value, ",") {
+		switch kind {
+		case "all", "link", "volumesFrom", "net":
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// validPullPolicy checks whether the given policy is known,
+// an empty one being valid as well
+func validPullPolicy(policy string) bool {
+	switch policy {
+	case "", PullAlways, PullMissing, PullNever:
+		return true
+	}
+	return false
+}
+
 // generateGraph generated the dependency graph, which is
 // a map describing the dependencies between the containers.
 func (c *config) DependencyGraph() DependencyGraph {
@@ -181,9 +471,14 @@ func (c *config) DependencyGraph() DependencyGraph {
 
 // determineTarget receives the specified target
 // and determines which containers should be targeted.
+// Excluded containers are left out, even if cascading
+// would include them.
 // Additionally, ot sorts these alphabetically.
 func (c *config) determineTarget(target []string, cascadeDependencies string, cascadeAffected string) {
+	cascadeDependencies, cascadeAffected = c.groupCascading(target, cascadeDependencies, cascadeAffected)
+
 	// start from the explicitly targeted target
+	c.reasons = make(map[string]string)
 	includedSet := make(map[string]bool)
 	cascadingSeeds := []string{}
 	for _, name := range c.explicitlyTargeted(target) {
@@ -191,8 +486,9 @@ func (c *config) determineTarget(target []string, cascadeDependencies string, ca
 		cascadingSeeds = append(cascadingSeeds, name)
 	}
 
-	// cascade until the graph has been fully traversed according to the cascading flags
-	for len(cascadingSeeds) > 0 {
+	// cascade until the graph has been fully traversed according to the cascading flags,
+	// or until the maximum depth has been reached
+	for depth := 1; len(cascadingSeeds) > 0 && (c.cascadeDepth <= 0 || depth <= c.cascadeDepth); depth++ {
 		nextCascadingSeeds := []string{}
 		for _, seed := range cascadingSeeds {
 			if cascadeDependencies != "none" {
@@ -201,17 +497,20 @@ func (c *config) determineTarget(target []string, cascadeDependencies string, ca
 					for _, name := range dependencies.forKind(cascadeDependencies) {
 						if _, alreadyIncluded := includedSet[name]; !alreadyIncluded {
 							includedSet[name] = true
+							c.explain(name, fmt.Sprintf("dependency of %s through %s", seed, dependencies.kind(name)))
 							nextCascadingSeeds = append(nextCascadingSeeds, name)
 						}
 					}
 				}
 			}
 			if cascadeAffected != "none" {
-				// queue all containers we haven't considered yet which exist & directly depend on the seed
+				// queue all containers we haven't considered yet which exist (unless requested otherwise)
+				// & directly depend on the seed, except tasks
 				for name, container := range c.containerMap {
 					if _, alreadyIncluded := includedSet[name]; !alreadyIncluded {
-						if container.Dependencies().includesAsKind(seed, cascadeAffected) && container.Exists() {
+						if container.Kind() != KindTask && container.Dependencies().includesAsKind(seed, cascadeAffected) && (c.cascadeNonExisting || container.Exists()) {
 							includedSet[name] = true
+							c.explain(name, fmt.Sprintf("affected by %s through %s", seed, container.Dependencies().kind(seed)))
 							nextCascadingSeeds = append(nextCascadingSeeds, name)
 						}
 					}
@@ -221,6 +520,16 @@ func (c *config) determineTarget(target []string, cascadeDependencies string, ca
 		cascadingSeeds = nextCascadingSeeds
 	}
 
+	// drop the excluded ones
+	_, exclusions := splitReferences(target)
+	for _, reference := range exclusions {
+		names, _ := c.resolveReference(reference)
+		for _, name := range names {
+			delete(includedSet, name)
+			delete(c.reasons, name)
+		}
+	}
+
 	// keep the ones that we know of
 	included := []string{}
 	for name := range includedSet {
@@ -234,55 +543,156 @@ func (c *config) determineTarget(target []string, cascadeDependencies string, ca
 	sort.Strings(c.target)
 }
 
+// groupCascading returns the cascading values to use, falling back
+// to the settings of the targeted groups (or of the default group if
+// no target is given) and of the groups nested in them, outer ones
+// first, for the ones which are not set. Unset values which no group
+// sets either default to none.
+func (c *config) groupCascading(target []string, cascadeDependencies string, cascadeAffected string) (string, string) {
+	inclusions, _ := splitReferences(target)
+	if len(inclusions) == 0 {
+		inclusions = []string{"default"}
+	}
+	for _, reference := range inclusions {
+		for _, group := range nestedGroups(c.groupReferences, reference) {
+			settings := c.groupSettings[group]
+			if len(cascadeDependencies) == 0 {
+				cascadeDependencies = settings.CascadeDependencies
+			}
+			if len(cascadeAffected) == 0 {
+				cascadeAffected = settings.CascadeAffected
+			}
+		}
+	}
+	if len(cascadeDependencies) == 0 {
+		cascadeDependencies = "none"
+	}
+	if len(cascadeAffected) == 0 {
+		cascadeAffected = "none"
+	}
+	return cascadeDependencies, cascadeAffected
+}
+
 // explicitlyTargeted receives a target and determines which
-// containers of the map are targeted
+// containers of the map are targeted. Exclusions are ignored.
 func (c *config) explicitlyTargeted(target []string) (result []string) {
 	result = []string{}
+	inclusions, _ := splitReferences(target)
 	// target not given
-	if len(target) == 0 ||
-		(len(target) == 1 && target[0] == "") { //FIXME: remove when -t/--target is removed
+	if len(inclusions) == 0 {
 		// If default group exists, return its containers
-		for group, containers := range c.groups {
-			if group == "default" {
-				return containers
+		if containers, ok := c.groups["default"]; ok {
+			for _, name := range containers {
+				c.explain(name, "via group default")
 			}
+			return containers
 		}
-		// If no default group exists, return all containers
-		for name, _ := range c.containerMap {
-			result = append(result, name)
+		// If no default group exists, return all containers except tasks
+		for name, container := range c.containerMap {
+			if container.Kind() != KindTask {
+				c.explain(name, "all containers (no target given)")
+				result = append(result, name)
+			}
 		}
 		return
 	}
 	// target given
-	for _, reference := range target {
-		success := false
-		reference = os.ExpandEnv(reference)
-		// Select reference from listed groups
-		for group, containers := range c.groups {
-			if group == reference {
-				result = append(result, containers...)
-				success = true
-				break
+	for _, reference := range inclusions {
+		names, reason := c.resolveReference(reference)
+		for _, name := range names {
+			c.explain(name, reason)
+		}
+		result = append(result, names...)
+	}
+	return
+}
+
+// splitReferences splits the references of the target, each of them
+// possibly being a comma-separated list, into inclusions and exclusions
+// (which are prefixed with a dash)
+func splitReferences(target []string) (inclusions []string, exclusions []string) {
+	for _, references := range target {
+		for _, reference := range strings.Split(os.ExpandEnv(references), ",") {
+			reference = strings.TrimSpace(reference)
+			if len(reference) == 0 {
+				continue
+			}
+			if strings.HasPrefix(reference, "-") {
+				exclusions = append(exclusions, reference[1:])
+			} else {
+				inclusions = append(inclusions, reference)
 			}
 		}
-		if success {
-			continue
+	}
+	return
+}
+
+// resolveReference returns the containers a reference stands for, along
+// with the reason for targeting them. A reference is either a group, a
+// container, `all`, a glob pattern (e.g. `web-*`) or a regular expression
+// prefixed with `re:` (e.g. `re:^svc-`), patterns being matched against
+// the names of both groups and containers.
+func (c *config) resolveReference(reference string) (names []string, reason string) {
+	// Select reference from listed groups
+	if containers, ok := c.groups[reference]; ok {
+		return containers, "via group " + reference
+	}
+	// The reference might just be one container
+	if _, ok := c.containerMap[reference]; ok {
+		return []string{reference}, "explicit"
+	}
+	if reference == "all" {
+		for name, container := range c.containerMap {
+			if container.Kind() != KindTask {
+				names = append(names, name)
+			}
+		}
+		return names, "all containers"
+	}
+	// The reference might be a pattern
+	var matches func(name string) bool
+	if strings.HasPrefix(reference, "re:") {
+		expression, err := regexp.Compile(reference[3:])
+		if err != nil {
+			panic(StatusError{fmt.Errorf("Invalid regular expression `%s`: %s", reference, err), 64})
+		}
+		matches = expression.MatchString
+	} else if strings.ContainsAny(reference, "*?[") {
+		if _, err := path.Match(reference, ""); err != nil {
+			panic(StatusError{fmt.Errorf("Invalid pattern `%s`: %s", reference, err), 64})
+		}
+		matches = func(name string) bool {
+			matched, _ := path.Match(reference, name)
+			return matched
+		}
+	}
+	if matches != nil {
+		// like `all`, patterns leave out the tasks
+		task := func(name string) bool {
+			container, ok := c.containerMap[name]
+			return ok && container.Kind() == KindTask
 		}
-		// The reference might just be one container
-		for name, _ := range c.containerMap {
-			if name == reference {
-				result = append(result, reference)
-				success = true
-				break
+		for group, containers := range c.groups {
+			if matches(group) {
+				for _, name := range containers {
+					if !task(name) {
+						names = append(names, name)
+					}
+				}
 			}
 		}
-		if success {
-			continue
+		for name := range c.containerMap {
+			if matches(name) && !task(name) {
+				names = append(names, name)
+			}
+		}
+		if len(names) > 0 {
+			sort.Strings(names)
+			return names, "matching `" + reference + "`"
 		}
-		// Otherwise, fail verbosely
-		panic(StatusError{fmt.Errorf("No group or container matching `%s`", reference), 64})
 	}
-	return
+	// Otherwise, fail verbosely
+	panic(StatusError{fmt.Errorf("No group or container matching `%s`", reference), 64})
 }
 
 // includes checks whether the given needle is
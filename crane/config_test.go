@@ -68,7 +68,7 @@ func TestUnmarshalJSON(t *testing.T) {
 	if len(actual.RawContainerMap["apache"].RunParams.Link()) != 2 {
 		t.Errorf("Container should have been linked to 2 other containers, got %v", actual.RawContainerMap["apache"].RunParams.Link())
 	}
-	if group, ok := actual.RawGroups["default"]; !ok || len(group) != 1 {
+	if group, ok := actual.RawGroups["default"].([]interface{}); !ok || len(group) != 1 {
 		t.Errorf("Config should have one `default` group with one container, got %v", actual.RawGroups)
 	}
 }
@@ -95,7 +95,7 @@ groups:
 	if len(actual.RawContainerMap["apache"].RunParams.Link()) != 2 {
 		t.Errorf("Container should have been linked to 2 other containers, got %v", actual.RawContainerMap["apache"].RunParams.Link())
 	}
-	if group, ok := actual.RawGroups["default"]; !ok || len(group) != 1 {
+	if group, ok := actual.RawGroups["default"].([]interface{}); !ok || len(group) != 1 {
 		t.Errorf("Config should have one `default` group with one container, got %v", actual.RawGroups)
 	}
 }
@@ -124,7 +124,7 @@ func TestGraph(t *testing.T) {
 		t.Errorf("Expecting the graph to contain all containers (defined in %v), got %v", containerMap, dependencyGraph)
 	}
 	// make sure a new graph is returned each time
-	dependencyGraph.resolve("a") // mutate the previous graph
+	delete(dependencyGraph, "a") // mutate the previous graph
 	dependencyGraph = c.DependencyGraph()
 	if len(dependencyGraph) != 3 {
 		t.Errorf("Expecting the graph to contain all containers (defined in %v), got %v", containerMap, dependencyGraph)
@@ -386,3 +386,301 @@ func TestTargetedContainers(t *testing.T) {
 		t.Errorf("Expected [b a], got %v", containers)
 	}
 }
+
+func TestSetPullPolicies(t *testing.T) {
+	rawContainerMap := containerMap{
+		"a": &container{RawName: "a"},
+		"b": &container{RawName: "b", RawPull: "never"},
+	}
+	c := &config{RawContainerMap: rawContainerMap, RawPull: "always"}
+	c.setPullPolicies("")
+	if rawContainerMap["a"].PullPolicy() != "always" || rawContainerMap["b"].PullPolicy() != "never" {
+		t.Errorf("Pull policies should have been always and never, got %s and %s", rawContainerMap["a"].PullPolicy(), rawContainerMap["b"].PullPolicy())
+	}
+	c.setPullPolicies("missing")
+	if rawContainerMap["a"].PullPolicy() != "missing" || rawContainerMap["b"].PullPolicy() != "missing" {
+		t.Errorf("Pull policies should have been overridden with missing, got %s and %s", rawContainerMap["a"].PullPolicy(), rawContainerMap["b"].PullPolicy())
+	}
+	// Invalid policy
+	defer func() {
+		if recover() == nil {
+			t.Errorf("Invalid pull policy should have caused a panic")
+		}
+	}()
+	c.setPullPolicies("sometimes")
+}
+
+func TestSetLabels(t *testing.T) {
+	rawContainerMap := containerMap{
+		"a": &container{RawName: "a"},
+	}
+	c := &config{RawContainerMap: rawContainerMap, path: "/home/user/project/crane.yml"}
+	if c.project() != "project" {
+		t.Errorf("Project should have been project, got %s", c.project())
+	}
+	c.setLabels()
+	expected := []string{"crane.project=project", "crane.config=/home/user/project/crane.yml"}
+	if !reflect.DeepEqual(rawContainerMap["a"].labels, expected) {
+		t.Errorf("Labels should have been %v, got %v", expected, rawContainerMap["a"].labels)
+	}
+}
+
+func TestTargetReasons(t *testing.T) {
+	containerMap := NewStubbedContainerMap(true,
+		&container{RawName: "a", RunParams: RunParameters{RawLink: []string{"b:b"}}},
+		&container{RawName: "b", RunParams: RunParameters{RawVolumesFrom: []string{"c"}}},
+		&container{RawName: "c"},
+		&container{RawName: "d", RunParams: RunParameters{RawNet: "container:c"}},
+	)
+	groups := map[string][]string{"backend": []string{"b"}}
+	c := &config{containerMap: containerMap, groups: groups}
+	c.dependencyGraph = c.DependencyGraph()
+	c.determineTarget([]string{"a", "backend"}, "all", "net")
+	expected := map[string]string{
+		"a": "explicit",
+		"b": "via group backend",
+		"c": "dependency of b through volumesFrom",
+		"d": "affected by c through net",
+	}
+	if !reflect.DeepEqual(c.TargetReasons(), expected) {
+		t.Errorf("Reasons should have been %v, got %v", expected, c.TargetReasons())
+	}
+}
+
+func TestTargetPatternsAndExclusions(t *testing.T) {
+	containerMap := NewStubbedContainerMap(true,
+		&container{RawName: "web-a", RunParams: RunParameters{RawLink: []string{"mysql:db"}}},
+		&container{RawName: "web-b"},
+		&container{RawName: "svc-a"},
+		&container{RawName: "mysql"},
+		&container{RawName: "web-migrate", RawKind: "task"},
+	)
+	groups := map[string][]string{"services": []string{"svc-a"}, "web": []string{"web-a", "web-migrate"}}
+	c := &config{containerMap: containerMap, groups: groups}
+	c.dependencyGraph = c.DependencyGraph()
+
+	examples := []struct {
+		target   []string
+		expected Target
+	}{
+		{target: []string{"web-*"}, expected: Target{"web-a", "web-b"}},
+		{target: []string{"re:^svc-"}, expected: Target{"svc-a"}},
+		{target: []string{"re:^serv"}, expected: Target{"svc-a"}},
+		{target: []string{"re:^we"}, expected: Target{"web-a", "web-b"}},
+		{target: []string{"web-migrate"}, expected: Target{"web-migrate"}},
+		{target: []string{"all,-mysql"}, expected: Target{"svc-a", "web-a", "web-b"}},
+		{target: []string{"web-b,svc-a"}, expected: Target{"svc-a", "web-b"}},
+		{target: []string{"all", "-web-*", "-services"}, expected: Target{"mysql"}},
+	}
+	for _, example := range examples {
+		c.determineTarget(example.target, "none", "none")
+		if !reflect.DeepEqual(c.target, example.expected) {
+			t.Errorf("Target for %v should have been %v, got %v", example.target, example.expected, c.target)
+		}
+	}
+
+	// exclusions win over cascading
+	c.determineTarget([]string{"web-a", "-mysql"}, "all", "none")
+	if !reflect.DeepEqual(c.target, Target{"web-a"}) {
+		t.Errorf("Target should have been [web-a], got %v", c.target)
+	}
+
+	// unmatched patterns fail
+	defer func() {
+		if recover() == nil {
+			t.Errorf("Unmatched pattern should have caused a panic")
+		}
+	}()
+	c.determineTarget([]string{"db-*"}, "none", "none")
+}
+
+func TestGroupSettings(t *testing.T) {
+	c := unmarshalYAML([]byte(
+		`containers:
+  web:
+    run:
+      env: ["B=3"]
+  db: {}
+groups:
+  all:
+    containers: [frontend, db]
+    env: ["A=0", "C=0"]
+  frontend:
+    containers: [web]
+    env: ["A=1", "B=2"]
+    cascade-dependencies: link
+`))
+	c.expandEnv()
+	if !reflect.DeepEqual(c.groups["all"], []string{"web", "db"}) {
+		t.Errorf("Group all should have contained web and db, got %v", c.groups["all"])
+	}
+	expectedEnv := []string{"A=0", "C=0", "A=1", "B=2", "B=3"}
+	if env := c.containerMap["web"].(*container).RunParams.Env(); !reflect.DeepEqual(env, expectedEnv) {
+		t.Errorf("Env of web should have been %v, got %v", expectedEnv, env)
+	}
+	if env := c.containerMap["db"].(*container).RunParams.Env(); !reflect.DeepEqual(env, []string{"A=0", "C=0"}) {
+		t.Errorf("Env of db should have been the one of group all, got %v", env)
+	}
+	if dependencies, affected := c.groupCascading([]string{"frontend"}, "", ""); dependencies != "link" || affected != "none" {
+		t.Errorf("Cascading should have been link and none, got %s and %s", dependencies, affected)
+	}
+	if dependencies, _ := c.groupCascading([]string{"all"}, "", ""); dependencies != "link" {
+		t.Errorf("Cascading of nested group should have been used, got %s", dependencies)
+	}
+	if dependencies, _ := c.groupCascading([]string{"frontend"}, "all", ""); dependencies != "all" {
+		t.Errorf("Cascading flag should have taken precedence, got %s", dependencies)
+	}
+	if dependencies, _ := c.groupCascading([]string{"frontend"}, "none", ""); dependencies != "none" {
+		t.Errorf("Explicit none should have taken precedence, got %s", dependencies)
+	}
+}
+
+func TestDetermineTargetCascadingKindsAndDepth(t *testing.T) {
+	containerMap := NewStubbedContainerMap(true,
+		&container{RawName: "a", RunParams: RunParameters{RawLink: []string{"b:b"}, RawVolumesFrom: []string{"v"}}},
+		&container{RawName: "b", RunParams: RunParameters{RawNet: "container:c"}},
+		&container{RawName: "c"},
+		&container{RawName: "v"},
+	)
+	c := &config{containerMap: containerMap}
+	c.dependencyGraph = c.DependencyGraph()
+
+	c.determineTarget([]string{"a"}, "link,net", "none")
+	if !reflect.DeepEqual(c.target, Target{"a", "b", "c"}) {
+		t.Errorf("Target should have been [a b c], got %v", c.target)
+	}
+	c.cascadeDepth = 1
+	c.determineTarget([]string{"a"}, "all", "none")
+	if !reflect.DeepEqual(c.target, Target{"a", "b", "v"}) {
+		t.Errorf("Target should have been [a b v], got %v", c.target)
+	}
+	c.determineTarget([]string{"c"}, "none", "all")
+	if !reflect.DeepEqual(c.target, Target{"b", "c"}) {
+		t.Errorf("Target should have been [b c], got %v", c.target)
+	}
+
+	// non-existing affected containers
+	containerMap["a"].(*StubbedContainer).exists = false
+	c.cascadeDepth = 0
+	c.determineTarget([]string{"c"}, "none", "all")
+	if !reflect.DeepEqual(c.target, Target{"b", "c"}) {
+		t.Errorf("Target should have been [b c], got %v", c.target)
+	}
+	c.cascadeNonExisting = true
+	c.determineTarget([]string{"c"}, "none", "all")
+	if !reflect.DeepEqual(c.target, Target{"a", "b", "c"}) {
+		t.Errorf("Target should have been [a b c], got %v", c.target)
+	}
+}
+
+func TestValidCascadingValue(t *testing.T) {
+	for _, value := range []string{"none", "all", "link", "link,net", "volumesFrom,link,net"} {
+		if !validCascadingValue(value) {
+			t.Errorf("%s should have been valid", value)
+		}
+	}
+	for _, value := range []string{"", "none,link", "link,", "links"} {
+		if validCascadingValue(value) {
+			t.Errorf("%s should have been invalid", value)
+		}
+	}
+}
+
+func TestSetNetworks(t *testing.T) {
+	c := unmarshalYAML([]byte(
+		`networks:
+  backend:
+    driver: overlay
+  frontend:
+links-as-aliases: true
+containers:
+  web:
+    run:
+      link: ["api:backend-api"]
+      networks: ["frontend"]
+  api:
+    run:
+      networks: ["backend"]
+      aliases: ["service"]
+`))
+	c.path = "/home/user/project/crane.yml"
+	c.expandEnv()
+	c.setNetworks()
+	if len(c.networkMap) != 3 || c.networkMap["backend"].Driver() != "overlay" || c.networkMap["frontend"] == nil || c.networkMap["project_default"] == nil {
+		t.Errorf("Networks should have been backend, frontend and project_default, got %v", c.networkMap)
+	}
+	web := c.RawContainerMap["web"]
+	if networks := web.Networks(); !reflect.DeepEqual(networks, []string{"frontend", "project_default"}) {
+		t.Errorf("Networks of web should have been [frontend project_default], got %v", networks)
+	}
+	api := c.RawContainerMap["api"]
+	if aliases := api.Aliases(); !reflect.DeepEqual(aliases, []string{"service", "backend-api"}) {
+		t.Errorf("Aliases of api should have been [service backend-api], got %v", aliases)
+	}
+	// links still determine the order
+	if !web.Dependencies().includesAsKind("api", "link") {
+		t.Errorf("web should still depend on api")
+	}
+	// net cannot be combined with networks
+	api.RunParams.RawNet = "host"
+	defer func() {
+		if recover() == nil {
+			t.Errorf("Combining net with networks should have caused a panic")
+		}
+	}()
+	c.setNetworks()
+}
+
+func TestSetKinds(t *testing.T) {
+	rawContainerMap := containerMap{
+		"a": &container{RawName: "a", RunParams: RunParameters{Detach: true}},
+		"b": &container{RawName: "b", RawKind: "task", RunParams: RunParameters{Detach: true}},
+	}
+	c := &config{RawContainerMap: rawContainerMap}
+	c.setKinds()
+	if a := rawContainerMap["a"]; a.Kind() != KindService || !a.RunParams.Detach || a.RunParams.Rm {
+		t.Errorf("Container a should have been a detached service, got %v", a)
+	}
+	if b := rawContainerMap["b"]; b.Kind() != KindTask || b.RunParams.Detach || !b.RunParams.Rm {
+		t.Errorf("Container b should have been a task run in the foreground and removed, got %v", b)
+	}
+	// Tasks are not part of all containers
+	c.containerMap = ContainerMap{"a": rawContainerMap["a"], "b": rawContainerMap["b"]}
+	if names, _ := c.resolveReference("all"); !reflect.DeepEqual(names, []string{"a"}) {
+		t.Errorf("All containers should have been [a], got %v", names)
+	}
+	c.reasons = make(map[string]string)
+	if names := c.explicitlyTargeted([]string{}); !reflect.DeepEqual(names, []string{"a"}) {
+		t.Errorf("Containers targeted without target should have been [a], got %v", names)
+	}
+	// Invalid kind
+	rawContainerMap["c"] = &container{RawName: "c", RawKind: "job"}
+	defer func() {
+		if recover() == nil {
+			t.Errorf("Invalid kind should have caused a panic")
+		}
+	}()
+	c.setKinds()
+}
+
+func TestOrphaned(t *testing.T) {
+	c := &config{containerMap: NewStubbedContainerMap(true, &container{RawName: "web"})}
+	examples := map[string]bool{
+		"web":          false,
+		"web-next":     false,
+		"web-old":      false,
+		"test-k3j2a":   false,
+		"api":          true,
+		"api-next":     true,
+		"web-next-old": true,
+	}
+	for name, expected := range examples {
+		kind := ""
+		if name == "test-k3j2a" {
+			kind = KindTask
+		}
+		if orphaned := c.orphaned(name, kind); orphaned != expected {
+			t.Errorf("Container %s should have been orphaned: %v, got %v", name, expected, orphaned)
+		}
+	}
+}
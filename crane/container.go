@@ -1,48 +1,113 @@
 package crane
 
 import (
+	"encoding/json"
 	"fmt"
 	"github.com/michaelsauter/crane/print"
 	"os"
 	"path"
+	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
+	"time"
 )
 
+// Number of seconds Docker waits for a container to stop
+const defaultStopTimeout = 10
+
 type Container interface {
 	Name() string
+	Kind() string
 	Dockerfile() string
+	WatchPaths() []string
 	Image() string
+	Tags() []string
 	Id() string
+	PullPolicy() string
 	Dependencies() *Dependencies
 	Exists() bool
 	Running() bool
 	Paused() bool
 	ImageExists() bool
+	ImageOutdated() bool
+	ImageId() string
+	Definition() string
+	DefinitionChanges() (changes []FieldDiff, known bool)
+	Diff() []FieldDiff
 	Status() []string
 	Provision(nocache bool)
 	ProvisionOrSkip(update bool, nocache bool)
 	Run()
 	Start()
 	RunOrStart()
+	RunTask(args []string)
+	Update(timeout int, wait int)
+	RollingUpdateError() error
+	LegacyLinks() bool
 	Kill()
-	Stop()
+	Stop(timeout int)
+	Terminate(timeout int)
 	Pause()
 	Unpause()
-	Rm()
+	Rm(volumes bool)
+	RmImage()
+	RmNetworks()
+	NamedVolumes() []string
+	RmNamedVolumes()
+	BackupVolumes(archive string, helperImage string)
+	RestoreVolumes(archive string, helperImage string)
 	Push()
 }
 
+// Labels set on every container created by crane
+const (
+	projectLabel    = "crane.project"
+	configLabel     = "crane.config"
+	definitionLabel = "crane.definition"
+	// set on the throwaway containers of tasks, and
+	// on the containers replacing others during updates
+	kindLabel = "crane.kind"
+)
+
 type container struct {
 	id            string
+	labels        []string
+	hookDir       string
+	networkMap    NetworkMap
+	sharedNetwork string
+	linkAliases   []string
+	volumeMap     VolumeMap
 	RawName       string
+	RawKind       string          `json:"kind" yaml:"kind"`
 	RawDockerfile string          `json:"dockerfile" yaml:"dockerfile"`
 	RawImage      string          `json:"image" yaml:"image"`
+	RawPull       string          `json:"pull" yaml:"pull"`
+	RawTags       []string        `json:"tags" yaml:"tags"`
+	Instances     int             `json:"instances" yaml:"instances"`
+	RawWatch      []string        `json:"watch" yaml:"watch"`
 	RunParams     RunParameters   `json:"run" yaml:"run"`
 	RmParams      RmParameters    `json:"rm" yaml:"rm"`
 	StartParams   StartParameters `json:"start" yaml:"start"`
+	StopParams    StopParameters  `json:"stop" yaml:"stop"`
+	Hooks         Hooks           `json:"hooks" yaml:"hooks"`
 }
 
+// Kinds of containers. Services are long-running containers,
+// while tasks are run on demand in throwaway containers.
+const (
+	KindService = "service"
+	KindTask    = "task"
+)
+
+// Pull policies, determining when images of containers
+// without a Dockerfile are pulled from the registry
+const (
+	PullAlways  = "always"
+	PullMissing = "missing"
+	PullNever   = "never"
+)
+
 type RunParameters struct {
 	RawCidfile     string      `json:"cidfile" yaml:"cidfile"`
 	CpuShares      int         `json:"cpu-shares" yaml:"cpu-shares"`
@@ -58,6 +123,8 @@ type RunParameters struct {
 	RawLxcConf     []string    `json:"lxc-conf" yaml:"lxc-conf"`
 	RawMemory      string      `json:"memory" yaml:"memory"`
 	RawNet         string      `json:"net" yaml:"net"`
+	RawNetworks    []string    `json:"networks" yaml:"networks"`
+	RawAliases     []string    `json:"aliases" yaml:"aliases"`
 	Privileged     bool        `json:"privileged" yaml:"privileged"`
 	RawPublish     []string    `json:"publish" yaml:"publish"`
 	PublishAll     bool        `json:"publish-all" yaml:"publish-all"`
@@ -79,6 +146,12 @@ type StartParameters struct {
 	Interactive bool `json:"interactive" yaml:"interactive"`
 }
 
+type StopParameters struct {
+	// nil if not configured, as 0 is a valid timeout
+	Timeout   *int   `json:"timeout" yaml:"timeout"`
+	RawSignal string `json:"signal" yaml:"signal"`
+}
+
 func (c *container) Dependencies() *Dependencies {
 	var linkParts []string
 	dependencies := &Dependencies{}
@@ -110,14 +183,121 @@ func (c *container) Name() string {
 	return os.ExpandEnv(c.RawName)
 }
 
+func (c *container) Kind() string {
+	if kind := os.ExpandEnv(c.RawKind); len(kind) > 0 {
+		return kind
+	}
+	return KindService
+}
+
 func (c *container) Dockerfile() string {
 	return os.ExpandEnv(c.RawDockerfile)
 }
 
+// WatchPaths returns the build context (if any)
+// followed by the configured watch paths
+func (c *container) WatchPaths() []string {
+	var paths []string
+	if len(c.Dockerfile()) > 0 {
+		paths = append(paths, c.Dockerfile())
+	}
+	for _, rawWatch := range c.RawWatch {
+		paths = append(paths, os.ExpandEnv(rawWatch))
+	}
+	return paths
+}
+
 func (c *container) Image() string {
 	return os.ExpandEnv(c.RawImage)
 }
 
+// Tags returns the additional references the image
+// is tagged with, e.g. `registry/app:latest` for the
+// tag `latest` of the image `registry/app:1.0`
+func (c *container) Tags() []string {
+	var tags []string
+	repository := imageRepository(c.Image())
+	for _, rawTag := range c.RawTags {
+		tags = append(tags, repository+":"+os.ExpandEnv(rawTag))
+	}
+	return tags
+}
+
+// Networks returns the networks the container joins,
+// including the default one if links are translated
+func (c *container) Networks() []string {
+	networks := c.RunParams.Networks()
+	if len(c.sharedNetwork) > 0 && !Target(networks).includes(c.sharedNetwork) {
+		networks = append(networks, c.sharedNetwork)
+	}
+	return networks
+}
+
+// Aliases returns the aliases of the container in its networks,
+// including the ones given by the links of other containers
+func (c *container) Aliases() []string {
+	aliases := c.RunParams.Aliases()
+	for _, alias := range c.linkAliases {
+		if !Target(aliases).includes(alias) {
+			aliases = append(aliases, alias)
+		}
+	}
+	return aliases
+}
+
+// Volumes returns the volumes of the container. Host paths are made
+// absolute, unless they refer to a named volume declared in the config.
+func (c *container) Volumes() []string {
+	var volumes []string
+	absolute := c.RunParams.Volume()
+	for i, rawVolume := range c.RunParams.RawVolume {
+		volume := os.ExpandEnv(rawVolume)
+		if paths := strings.Split(volume, ":"); len(paths) > 1 && c.volumeMap[paths[0]] != nil {
+			volumes = append(volumes, volume)
+		} else {
+			volumes = append(volumes, absolute[i])
+		}
+	}
+	return volumes
+}
+
+// NamedVolumes returns the names of the declared
+// named volumes the container uses
+func (c *container) NamedVolumes() []string {
+	var names []string
+	for _, rawVolume := range c.RunParams.RawVolume {
+		paths := strings.Split(os.ExpandEnv(rawVolume), ":")
+		if len(paths) > 1 && c.volumeMap[paths[0]] != nil && !Target(names).includes(paths[0]) {
+			names = append(names, paths[0])
+		}
+	}
+	return names
+}
+
+// PullPolicy returns the pull policy of the container,
+// or an empty string if none was configured
+func (c *container) PullPolicy() string {
+	return os.ExpandEnv(c.RawPull)
+}
+
+func (s *StopParameters) Signal() string {
+	return os.ExpandEnv(s.RawSignal)
+}
+
+// timeout returns the number of seconds to wait for the container
+// to stop, given a timeout passed on the command line which takes
+// precedence if it is not negative. A negative value means that
+// no timeout is set at all.
+func (s *StopParameters) timeout(override int) int {
+	if override >= 0 {
+		return override
+	}
+	if s.Timeout != nil && *s.Timeout >= 0 {
+		return *s.Timeout
+	}
+	return -1
+}
+
 func (r *RunParameters) Cidfile() string {
 	return os.ExpandEnv(r.RawCidfile)
 }
@@ -187,6 +367,22 @@ func (r *RunParameters) Net() string {
 	}
 }
 
+func (r *RunParameters) Networks() []string {
+	var networks []string
+	for _, rawNetwork := range r.RawNetworks {
+		networks = append(networks, os.ExpandEnv(rawNetwork))
+	}
+	return networks
+}
+
+func (r *RunParameters) Aliases() []string {
+	var aliases []string
+	for _, rawAlias := range r.RawAliases {
+		aliases = append(aliases, os.ExpandEnv(rawAlias))
+	}
+	return aliases
+}
+
 func (r *RunParameters) Publish() []string {
 	var publish []string
 	for _, rawPublish := range r.RawPublish {
@@ -289,6 +485,21 @@ func (c *container) ImageExists() bool {
 	}
 }
 
+// ImageOutdated checks whether the container was created from
+// another image than the one its image name refers to now
+func (c *container) ImageOutdated() bool {
+	if !c.Exists() {
+		return false
+	}
+	return inspectString(c.Id(), "{{.Image}}") != imageIdFromTag(c.Image())
+}
+
+// ImageId returns the id of the image of the
+// container, or an empty string if it doesn't exist
+func (c *container) ImageId() string {
+	return imageIdFromTag(c.Image())
+}
+
 func (c *container) Status() []string {
 	fields := []string{c.Name(), c.Image(), "-", "-", "-", "-", "-"}
 	output := inspectString(c.Id(), "{{.Id}}\t{{.Image}}\t{{if .NetworkSettings.IPAddress}}{{.NetworkSettings.IPAddress}}{{else}}-{{end}}\t{{range $k,$v := $.NetworkSettings.Ports}}{{$k}},{{else}}-{{end}}\t{{.State.Running}}")
@@ -304,7 +515,18 @@ func (c *container) Provision(nocache bool) {
 	if len(c.Dockerfile()) > 0 {
 		c.buildImage(nocache)
 	} else {
-		c.pullImage()
+		switch c.PullPolicy() {
+		case PullNever:
+			print.Noticef("Skipping pull of image %s as the pull policy is %s.\n", c.Image(), PullNever)
+		case PullMissing:
+			if c.ImageExists() {
+				print.Noticef("Skipping pull of image %s as it does already exist.\n", c.Image())
+			} else {
+				c.pullImage()
+			}
+		default:
+			c.pullImage()
+		}
 	}
 }
 
@@ -319,7 +541,7 @@ func (c *container) RunOrStart() {
 
 // Provision or skip container
 func (c *container) ProvisionOrSkip(update bool, nocache bool) {
-	if update || !c.ImageExists() {
+	if update || !c.ImageExists() || (len(c.Dockerfile()) == 0 && c.PullPolicy() == PullAlways) {
 		c.Provision(nocache)
 	}
 }
@@ -332,116 +554,365 @@ func (c *container) Run() {
 			c.Start()
 		}
 	} else {
+		if !c.pullBeforeRun() {
+			panic(StatusError{fmt.Errorf("Container %s cannot be run without its image", c.Name()), 1})
+		}
+		c.runHooks("before-run", c.Hooks.BeforeRun)
+		c.createNetworksAndVolumes()
 		fmt.Printf("Running container %s ... ", c.Name())
-		// Assemble command arguments
-		args := []string{"run"}
-		// Cidfile
-		if len(c.RunParams.Cidfile()) > 0 {
-			args = append(args, "--cidfile", c.RunParams.Cidfile())
+		args := c.runArgs(c.Name())
+		// Execute command
+		executeCommand("docker", args)
+		c.connectNetworks(c.Name())
+		c.runHooks("after-start", c.Hooks.AfterStart)
+		c.runHooks("after-run", c.Hooks.AfterRun)
+	}
+}
+
+// Update container without downtime: the new container is run under
+// a temporary name and, once it is ready, takes over the name of the
+// old one, which gets stopped and removed. If the new container does
+// not become ready within wait seconds, it is removed instead.
+func (c *container) Update(timeout int, wait int) {
+	if !c.Exists() {
+		c.Run()
+		return
+	}
+	if !c.pullBeforeRun() {
+		panic(StatusError{fmt.Errorf("Container %s cannot be updated without its image", c.Name()), 1})
+	}
+	c.runHooks("before-run", c.Hooks.BeforeRun)
+	c.createNetworksAndVolumes()
+	next := c.Name() + "-next"
+	fmt.Printf("Running container %s as %s ... ", c.Name(), next)
+	executeCommand("docker", c.runArgs(next, kindLabel+"=update"))
+	c.connectNetworks(next)
+	if !waitUntilReady(next, wait) {
+		fmt.Printf("Removing container %s ... ", next)
+		executeCommand("docker", []string{"rm", "--force", next})
+		panic(StatusError{fmt.Errorf("Container %s did not become ready within %d seconds", next, wait), 1})
+	}
+	previous := *c
+	previous.RawName = c.Name() + "-old"
+	previous.id = ""
+	fmt.Printf("Renaming container %s to %s ... ", c.Name(), previous.Name())
+	executeCommand("docker", []string{"rename", c.Name(), previous.Name()})
+	fmt.Printf("Renaming container %s to %s ... ", next, c.Name())
+	executeCommand("docker", []string{"rename", next, c.Name()})
+	c.id = ""
+	previous.Stop(timeout)
+	previous.Rm(false)
+	// the container replaces one which ran already,
+	// so the hooks of the first run are skipped
+	c.runHooks("after-start", c.Hooks.AfterStart)
+}
+
+// RollingUpdateError returns why the container cannot be
+// updated without downtime, or nil if it can. The new container
+// runs next to the old one for a moment, so they must not claim
+// the same host ports or cidfile, and it must run detached.
+func (c *container) RollingUpdateError() error {
+	if !c.RunParams.Detach {
+		return fmt.Errorf("container %s is not detached", c.Name())
+	}
+	if len(c.RunParams.Cidfile()) > 0 {
+		return fmt.Errorf("container %s uses a cidfile", c.Name())
+	}
+	for _, port := range c.RunParams.Publish() {
+		parts := strings.Split(normalizePort(port), ":")
+		if len(parts[len(parts)-2]) > 0 {
+			return fmt.Errorf("container %s publishes %s on a fixed host port", c.Name(), port)
 		}
-		// CPU shares
-		if c.RunParams.CpuShares > 0 {
-			args = append(args, "--cpu-shares", strconv.Itoa(c.RunParams.CpuShares))
+	}
+	return nil
+}
+
+// LegacyLinks checks whether the links of the container
+// are Docker links rather than network aliases
+func (c *container) LegacyLinks() bool {
+	return len(c.sharedNetwork) == 0
+}
+
+// connectNetworks connects the container run under the given
+// name to its networks, except the first one it was run in
+func (c *container) connectNetworks(name string) {
+	networks := c.Networks()
+	for i := 1; i < len(networks); i++ {
+		fmt.Printf("Connecting container %s to network %s ... ", name, networks[i])
+		args := []string{"network", "connect"}
+		for _, alias := range c.Aliases() {
+			args = append(args, "--alias", alias)
 		}
-		// Detach
-		if c.RunParams.Detach {
-			args = append(args, "--detach")
+		args = append(args, networks[i], name)
+		executeCommand("docker", args)
+	}
+}
+
+// waitUntilReady waits up to the given number of seconds for the
+// container to run and, if it has a health check, to be healthy
+func waitUntilReady(name string, wait int) bool {
+	deadline := time.Now().Add(time.Duration(wait) * time.Second)
+	for {
+		if inspectBool(name, "{{.State.Running}}") {
+			switch inspectString(name, "{{if .State.Health}}{{.State.Health.Status}}{{end}}") {
+			case "", "healthy":
+				return true
+			case "unhealthy":
+				return false
+			}
 		}
-		// Dns
-		for _, dns := range c.RunParams.Dns() {
-			args = append(args, "--dns", dns)
+		if time.Now().After(deadline) {
+			return false
 		}
-		// Entrypoint
-		if len(c.RunParams.Entrypoint()) > 0 {
-			args = append(args, "--entrypoint", c.RunParams.Entrypoint())
+		time.Sleep(500 * time.Millisecond)
+	}
+}
+
+// Run a task in a throwaway container with a unique name,
+// appending the given arguments to its command. The exit
+// status of the task is propagated.
+func (c *container) RunTask(args []string) {
+	if !c.pullBeforeRun() {
+		panic(StatusError{fmt.Errorf("Task %s cannot be run without its image", c.Name()), 1})
+	}
+	c.runHooks("before-run", c.Hooks.BeforeRun)
+	c.createNetworksAndVolumes()
+	name := c.Name() + "-" + strconv.FormatInt(time.Now().UnixNano(), 36)
+	fmt.Printf("Running task %s as container %s ... ", c.Name(), name)
+	executeCommand("docker", append(c.runArgs(name, kindLabel+"="+KindTask), args...))
+}
+
+// createNetworksAndVolumes creates the declared networks and
+// named volumes the container uses, unless they already exist
+func (c *container) createNetworksAndVolumes() {
+	for _, network := range c.Networks() {
+		if n, ok := c.networkMap[network]; ok {
+			n.Create()
 		}
-		// Env
-		for _, env := range c.RunParams.Env() {
-			args = append(args, "--env", env)
+	}
+	for _, name := range c.NamedVolumes() {
+		c.volumeMap[name].Create()
+	}
+}
+
+// runArgs assembles the arguments of `docker run` for the container,
+// run under the given name with the given extra labels, including its
+// command
+func (c *container) runArgs(name string, labels ...string) []string {
+	args := append([]string{"run"}, c.runOptions()...)
+	// Definition
+	args = append(args, "--label", definitionLabel+"="+c.Definition())
+	for _, label := range labels {
+		args = append(args, "--label", label)
+	}
+	// Name
+	args = append(args, "--name", name)
+	// Image
+	args = append(args, c.Image())
+	// Command
+	args = append(args, c.RunParams.Cmd()...)
+	return args
+}
+
+// options of `docker run` which do not take a value
+var booleanRunOptions = Target{"--detach", "--interactive", "--privileged", "--publish-all", "--rm", "--tty"}
+
+// definition maps the options the container is run with to their
+// values, along with its image and command. Labels are left out as
+// they identify the config, and volumes are kept as configured, so
+// that the definition neither depends on where the config is located
+// nor on the directory crane is run from.
+func (c *container) definition() map[string][]string {
+	definition := make(map[string][]string)
+	options := c.runOptions()
+	for i := 0; i < len(options); i++ {
+		option, value := options[i], "true"
+		if !booleanRunOptions.includes(option) && i+1 < len(options) {
+			i++
+			value = options[i]
 		}
-		// Env file
-		if len(c.RunParams.EnvFile()) > 0 {
-			args = append(args, "--env-file", c.RunParams.EnvFile())
+		if option == "--label" || option == "--volume" {
+			continue
 		}
-		// Expose
-		for _, expose := range c.RunParams.Expose() {
-			args = append(args, "--expose", expose)
+		field := strings.TrimPrefix(option, "--")
+		definition[field] = append(definition[field], value)
+	}
+	for _, rawVolume := range c.RunParams.RawVolume {
+		definition["volume"] = append(definition["volume"], os.ExpandEnv(rawVolume))
+	}
+	definition["image"] = []string{c.Image()}
+	if cmd := c.RunParams.Cmd(); len(cmd) > 0 {
+		definition["cmd"] = cmd
+	}
+	return definition
+}
+
+// Definition returns the definition of the container as JSON,
+// which the container is labelled with when it is run
+func (c *container) Definition() string {
+	data, _ := json.Marshal(c.definition())
+	return string(data)
+}
+
+// DefinitionChanges compares the current definition of the container
+// with the one it was run with, field by field. The definition is not
+// known if the container was run without the definition label, e.g. by
+// an older version of Crane.
+func (c *container) DefinitionChanges() (changes []FieldDiff, known bool) {
+	if !c.Exists() {
+		return nil, true
+	}
+	var previous map[string][]string
+	if err := json.Unmarshal([]byte(inspectString(c.Id(), "{{index .Config.Labels \""+definitionLabel+"\"}}")), &previous); err != nil {
+		return nil, false
+	}
+	return definitionChanges(c.definition(), previous), true
+}
+
+// definitionChanges returns the fields whose values differ between the
+// current and the previous definition, sorted by field. When only the
+// order of the values changed, all of them are listed.
+func definitionChanges(current map[string][]string, previous map[string][]string) []FieldDiff {
+	fields := []string{}
+	for field := range current {
+		fields = append(fields, field)
+	}
+	for field := range previous {
+		if _, ok := current[field]; !ok {
+			fields = append(fields, field)
 		}
-		// Host
-		if len(c.RunParams.Hostname()) > 0 {
-			args = append(args, "--hostname", c.RunParams.Hostname())
+	}
+	sort.Strings(fields)
+	changes := []FieldDiff{}
+	for _, field := range fields {
+		if strings.Join(current[field], "\x00") == strings.Join(previous[field], "\x00") {
+			continue
 		}
-		// Interactive
-		if c.RunParams.Interactive {
-			args = append(args, "--interactive")
+		configured, actual := difference(current[field], previous[field]), difference(previous[field], current[field])
+		if len(configured) == 0 && len(actual) == 0 {
+			configured, actual = current[field], previous[field]
 		}
-		// Link
+		changes = append(changes, FieldDiff{field, configured, actual})
+	}
+	return changes
+}
+
+// runOptions assembles the options of `docker run` for the container
+func (c *container) runOptions() []string {
+	var args []string
+	// Cidfile
+	if len(c.RunParams.Cidfile()) > 0 {
+		args = append(args, "--cidfile", c.RunParams.Cidfile())
+	}
+	// CPU shares
+	if c.RunParams.CpuShares > 0 {
+		args = append(args, "--cpu-shares", strconv.Itoa(c.RunParams.CpuShares))
+	}
+	// Detach
+	if c.RunParams.Detach {
+		args = append(args, "--detach")
+	}
+	// Dns
+	for _, dns := range c.RunParams.Dns() {
+		args = append(args, "--dns", dns)
+	}
+	// Entrypoint
+	if len(c.RunParams.Entrypoint()) > 0 {
+		args = append(args, "--entrypoint", c.RunParams.Entrypoint())
+	}
+	// Env
+	for _, env := range c.RunParams.Env() {
+		args = append(args, "--env", env)
+	}
+	// Env file
+	if len(c.RunParams.EnvFile()) > 0 {
+		args = append(args, "--env-file", c.RunParams.EnvFile())
+	}
+	// Expose
+	for _, expose := range c.RunParams.Expose() {
+		args = append(args, "--expose", expose)
+	}
+	// Host
+	if len(c.RunParams.Hostname()) > 0 {
+		args = append(args, "--hostname", c.RunParams.Hostname())
+	}
+	// Interactive
+	if c.RunParams.Interactive {
+		args = append(args, "--interactive")
+	}
+	// Link (unless translated into network aliases)
+	if len(c.sharedNetwork) == 0 {
 		for _, link := range c.RunParams.Link() {
 			args = append(args, "--link", link)
 		}
-		// LxcConf
-		for _, lxcConf := range c.RunParams.LxcConf() {
-			args = append(args, "--lxc-conf", lxcConf)
-		}
-		// Memory
-		if len(c.RunParams.Memory()) > 0 {
-			args = append(args, "--memory", c.RunParams.Memory())
-		}
-		// Net
-		if c.RunParams.Net() != "bridge" {
-			args = append(args, "--net", c.RunParams.Net())
-		}
-		// Privileged
-		if c.RunParams.Privileged {
-			args = append(args, "--privileged")
-		}
-		// Publish
-		for _, port := range c.RunParams.Publish() {
-			args = append(args, "--publish", port)
-		}
-		// PublishAll
-		if c.RunParams.PublishAll {
-			args = append(args, "--publish-all")
-		}
-		// Rm
-		if c.RunParams.Rm {
-			args = append(args, "--rm")
-		}
-		// Tty
-		if c.RunParams.Tty {
-			args = append(args, "--tty")
-		}
-		// User
-		if len(c.RunParams.User()) > 0 {
-			args = append(args, "--user", c.RunParams.User())
-		}
-		// Volumes
-		for _, volume := range c.RunParams.Volume() {
-			args = append(args, "--volume", volume)
-		}
-		// VolumesFrom
-		for _, volumeFrom := range c.RunParams.VolumesFrom() {
-			args = append(args, "--volumes-from", volumeFrom)
-		}
-		// Workdir
-		if len(c.RunParams.Workdir()) > 0 {
-			args = append(args, "--workdir", c.RunParams.Workdir())
+	}
+	// LxcConf
+	for _, lxcConf := range c.RunParams.LxcConf() {
+		args = append(args, "--lxc-conf", lxcConf)
+	}
+	// Memory
+	if len(c.RunParams.Memory()) > 0 {
+		args = append(args, "--memory", c.RunParams.Memory())
+	}
+	// Net (the first network takes precedence, the
+	// container is connected to the other ones afterwards)
+	networks := c.Networks()
+	if len(networks) > 0 {
+		args = append(args, "--net", networks[0])
+		for _, alias := range c.Aliases() {
+			args = append(args, "--net-alias", alias)
 		}
-		// Name
-		args = append(args, "--name", c.Name())
-		// Image
-		args = append(args, c.Image())
-		// Command
-		args = append(args, c.RunParams.Cmd()...)
-		// Execute command
-		executeCommand("docker", args)
+	} else if c.RunParams.Net() != "bridge" {
+		args = append(args, "--net", c.RunParams.Net())
+	}
+	// Privileged
+	if c.RunParams.Privileged {
+		args = append(args, "--privileged")
+	}
+	// Publish
+	for _, port := range c.RunParams.Publish() {
+		args = append(args, "--publish", port)
+	}
+	// PublishAll
+	if c.RunParams.PublishAll {
+		args = append(args, "--publish-all")
+	}
+	// Rm
+	if c.RunParams.Rm {
+		args = append(args, "--rm")
+	}
+	// Tty
+	if c.RunParams.Tty {
+		args = append(args, "--tty")
+	}
+	// User
+	if len(c.RunParams.User()) > 0 {
+		args = append(args, "--user", c.RunParams.User())
 	}
+	// Volumes
+	for _, volume := range c.Volumes() {
+		args = append(args, "--volume", volume)
+	}
+	// VolumesFrom
+	for _, volumeFrom := range c.RunParams.VolumesFrom() {
+		args = append(args, "--volumes-from", volumeFrom)
+	}
+	// Workdir
+	if len(c.RunParams.Workdir()) > 0 {
+		args = append(args, "--workdir", c.RunParams.Workdir())
+	}
+	// Labels
+	for _, label := range c.labels {
+		args = append(args, "--label", label)
+	}
+	return args
 }
 
 // Start container
 func (c *container) Start() {
 	if c.Exists() {
 		if !c.Running() {
+			c.createNetworksAndVolumes()
 			fmt.Printf("Starting container %s ... ", c.Name())
 			args := []string{"start"}
 			if c.StartParams.Attach {
@@ -452,6 +923,7 @@ func (c *container) Start() {
 			}
 			args = append(args, c.Name())
 			executeCommand("docker", args)
+			c.runHooks("after-start", c.Hooks.AfterStart)
 		}
 	} else {
 		print.Errorf("Container %s does not exist.\n", c.Name())
@@ -468,14 +940,47 @@ func (c *container) Kill() {
 }
 
 // Stop container
-func (c *container) Stop() {
+// If a stop signal is configured, it is sent to the container, which
+// gets killed if it does not stop within the timeout. Otherwise, docker
+// stop is used. A non-negative timeout overrides the configured one.
+func (c *container) Stop(timeout int) {
 	if c.Running() {
-		fmt.Printf("Stopping container %s ... ", c.Name())
-		args := []string{"stop", c.Name()}
-		executeCommand("docker", args)
+		c.runHooks("before-stop", c.Hooks.BeforeStop)
+		timeout = c.StopParams.timeout(timeout)
+		if len(c.StopParams.Signal()) > 0 {
+			fmt.Printf("Sending %s to container %s ... ", c.StopParams.Signal(), c.Name())
+			args := []string{"kill", "--signal=" + c.StopParams.Signal(), c.Name()}
+			executeCommand("docker", args)
+			if timeout < 0 {
+				timeout = defaultStopTimeout
+			}
+			deadline := time.Now().Add(time.Duration(timeout) * time.Second)
+			for c.Running() && time.Now().Before(deadline) {
+				time.Sleep(100 * time.Millisecond)
+			}
+			c.Kill()
+		} else {
+			fmt.Printf("Stopping container %s ... ", c.Name())
+			args := []string{"stop"}
+			if timeout >= 0 {
+				args = append(args, "--time="+strconv.Itoa(timeout))
+			}
+			args = append(args, c.Name())
+			executeCommand("docker", args)
+		}
 	}
 }
 
+// Terminate container
+// The container is stopped gracefully first if a stop timeout or
+// signal is given, and killed if it is still running afterwards.
+func (c *container) Terminate(timeout int) {
+	if c.StopParams.timeout(timeout) >= 0 || len(c.StopParams.Signal()) > 0 {
+		c.Stop(timeout)
+	}
+	c.Kill()
+}
+
 // Pause container
 func (c *container) Pause() {
 	if c.Running() {
@@ -501,13 +1006,15 @@ func (c *container) Unpause() {
 }
 
 // Remove container
-func (c *container) Rm() {
+// When volumes is true, its volumes are removed as well,
+// regardless of the configured rm parameters.
+func (c *container) Rm(volumes bool) {
 	if c.Exists() {
 		if c.Running() {
 			print.Errorf("Container %s is running and cannot be removed.\n", c.Name())
 		} else {
 			args := []string{"rm"}
-			if c.RmParams.Volumes {
+			if volumes || c.RmParams.Volumes {
 				fmt.Printf("Removing container %s and its volumes ... ", c.Name())
 				args = append(args, "--volumes")
 			} else {
@@ -520,24 +1027,199 @@ func (c *container) Rm() {
 	}
 }
 
+// Remove the image (and its tags) of container,
+// as long as it was built from a Dockerfile
+func (c *container) RmImage() {
+	if len(c.Dockerfile()) > 0 && c.ImageExists() {
+		fmt.Printf("Removing image %s ... ", c.Image())
+		args := append([]string{"rmi", c.Image()}, c.Tags()...)
+		executeCommand("docker", args)
+	}
+}
+
+// Remove the networks of container which were created by crane,
+// unless other containers are still attached to them
+func (c *container) RmNetworks() {
+	for _, network := range c.Networks() {
+		if n, ok := c.networkMap[network]; ok {
+			n.Rm()
+		}
+	}
+}
+
+// Remove the named volumes of container declared
+// in the config, unless other containers still use them
+func (c *container) RmNamedVolumes() {
+	for _, name := range c.NamedVolumes() {
+		c.volumeMap[name].Rm()
+	}
+}
+
+// Back up the volumes of container (including the ones it got via
+// volumes-from) into the given tar archive, using a throwaway
+// container of the helper image
+func (c *container) BackupVolumes(archive string, helperImage string) {
+	mounts, ok := c.mounts()
+	if !ok {
+		return
+	}
+	destinations := volumeDestinations(mounts)
+	if destinations == nil {
+		print.Noticef("Container %s does not have any volumes.\n", c.Name())
+		return
+	}
+	fmt.Printf("Backing up volumes of container %s to %s ... ", c.Name(), archive)
+	mount := helperMount(mounts)
+	args := append(c.volumeHelperArgs(archive, mount, helperImage), "tar", "cf", mount+"/"+filepath.Base(archive))
+	executeCommand("docker", append(args, destinations...))
+}
+
+// Restore the volumes of container from the given tar archive,
+// using a throwaway container of the helper image
+func (c *container) RestoreVolumes(archive string, helperImage string) {
+	if c.Running() {
+		print.Errorf("Container %s is running, stop it before restoring its volumes.\n", c.Name())
+		return
+	}
+	mounts, ok := c.mounts()
+	if !ok {
+		return
+	}
+	destinations := volumeDestinations(mounts)
+	if destinations == nil {
+		print.Noticef("Container %s does not have any volumes.\n", c.Name())
+		return
+	}
+	if _, err := os.Stat(archive); err != nil {
+		panic(StatusError{err, 66})
+	}
+	fmt.Printf("Restoring volumes of container %s from %s ... ", c.Name(), archive)
+	mount := helperMount(mounts)
+	args := append(c.volumeHelperArgs(archive, mount, helperImage), "tar", "xf", mount+"/"+filepath.Base(archive), "-C", "/")
+	// only extract into the volumes, leaving bind mounts alone
+	for _, destination := range destinations {
+		args = append(args, strings.TrimPrefix(destination, "/"))
+	}
+	executeCommand("docker", args)
+}
+
+// Mount is a volume or a bind mount
+// of a container, as inspected
+type Mount struct {
+	Type        string
+	Destination string
+}
+
+// mounts returns the mounts of the container,
+// and false if it does not exist
+func (c *container) mounts() ([]Mount, bool) {
+	if !c.Exists() {
+		print.Errorf("Container %s does not exist.\n", c.Name())
+		return nil, false
+	}
+	var mounts []Mount
+	if err := json.Unmarshal([]byte(inspectString(c.Id(), "{{json .Mounts}}")), &mounts); err != nil {
+		panic(StatusError{fmt.Errorf("Could not parse the mounts of container %s: %s", c.Name(), err), 65})
+	}
+	return mounts, true
+}
+
+// volumeDestinations returns the paths of the volumes among the
+// mounts, or nil if there are none. Bind mounts are left out, as
+// they belong to the host.
+func volumeDestinations(mounts []Mount) []string {
+	var destinations []string
+	for _, mount := range mounts {
+		if mount.Type == "volume" {
+			destinations = append(destinations, mount.Destination)
+		}
+	}
+	return destinations
+}
+
+// helperMount returns the path to mount the directory of the archive
+// under in the throwaway container, which must not overlap with the
+// given mounts
+func helperMount(mounts []Mount) string {
+	mount := "/crane-backup"
+	for i := 1; ; i++ {
+		overlaps := false
+		for _, m := range mounts {
+			destination := m.Destination
+			if destination == mount || strings.HasPrefix(destination, mount+"/") || strings.HasPrefix(mount, destination+"/") {
+				overlaps = true
+			}
+		}
+		if !overlaps {
+			return mount
+		}
+		mount = "/crane-backup-" + strconv.Itoa(i)
+	}
+}
+
+// volumeHelperArgs returns the arguments to run a throwaway container
+// sharing the volumes of container, with the directory of the archive
+// mounted under the given path
+func (c *container) volumeHelperArgs(archive string, mount string, helperImage string) []string {
+	dir, _ := filepath.Abs(filepath.Dir(archive))
+	return []string{"run", "--rm", "--volumes-from", c.Name(), "--volume", dir + ":" + mount, helperImage}
+}
+
 // Push container
 func (c *container) Push() {
 	if len(c.Image()) > 0 {
-		fmt.Printf("Pushing image %s ... ", c.Image())
-		args := []string{"push", c.Image()}
-		executeCommand("docker", args)
+		login(c.Image())
+		// pulled images were not tagged yet
+		c.tagImage()
+		for _, image := range append([]string{c.Image()}, c.Tags()...) {
+			fmt.Printf("Pushing image %s ... ", image)
+			args := []string{"push", image}
+			executeCommand("docker", args)
+		}
 	} else {
 		print.Noticef("Skipping %s as it does not have an image name.\n", c.Name())
 	}
 }
 
-// Pull image for container
+// images already pulled during this invocation
+var pulledImages = make(map[string]bool)
+
+// Pull image for container, unless it was already
+// pulled during this invocation
 func (c *container) pullImage() {
+	if pulledImages[c.Image()] {
+		return
+	}
+	pulledImages[c.Image()] = true
+	login(c.Image())
 	fmt.Printf("Pulling image %s ... ", c.Image())
 	args := []string{"pull", c.Image()}
 	executeCommand("docker", args)
 }
 
+// Pull the image of a container without Dockerfile before running it,
+// according to its pull policy. Returns false if the container cannot
+// be run because its image is missing and must not be pulled.
+func (c *container) pullBeforeRun() bool {
+	if len(c.Dockerfile()) > 0 {
+		return true
+	}
+	switch c.PullPolicy() {
+	case PullAlways:
+		c.pullImage()
+	case PullMissing:
+		if !c.ImageExists() {
+			c.pullImage()
+		}
+	case PullNever:
+		if !c.ImageExists() {
+			print.Errorf("Image %s does not exist and the pull policy is %s.\n", c.Image(), PullNever)
+			return false
+		}
+	}
+	return true
+}
+
 // Build image for container
 func (c *container) buildImage(nocache bool) {
 	fmt.Printf("Building image %s ... ", c.Image())
@@ -547,11 +1229,22 @@ func (c *container) buildImage(nocache bool) {
 	}
 	args = append(args, "--rm", "--tag="+c.Image(), c.Dockerfile())
 	executeCommand("docker", args)
+	c.tagImage()
+	c.runHooks("after-build", c.Hooks.AfterBuild)
+}
+
+// Tag the image of container with all of its tags
+func (c *container) tagImage() {
+	for _, tag := range c.Tags() {
+		fmt.Printf("Tagging image %s as %s ... ", c.Image(), tag)
+		executeCommand("docker", []string{"tag", c.Image(), tag})
+	}
 }
 
-// Return the image id of a tag, or an empty string if it doesn't exist
+// Return the image id of a tag, or an empty string if it doesn't exist.
+// Containers of the same name as the tag are not considered.
 func imageIdFromTag(tag string) string {
-	args := []string{"inspect", "--format={{.Id}}", tag}
+	args := []string{"inspect", "--type=image", "--format={{.Id}}", tag}
 	output, err := commandOutput("docker", args)
 	if err != nil {
 		return ""
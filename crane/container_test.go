@@ -1,7 +1,10 @@
 package crane
 
 import (
+	"encoding/json"
 	"os"
+	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -76,3 +79,136 @@ func TestCmd(t *testing.T) {
 		t.Errorf("Command should have been true, got %v", c.RunParams.Cmd())
 	}
 }
+
+func TestTags(t *testing.T) {
+	os.Clearenv()
+	os.Setenv("SHA", "abc123")
+	c := &container{RawImage: "localhost:5000/app:1.0", RawTags: []string{"$SHA", "latest"}}
+	tags := c.Tags()
+	if len(tags) != 2 || tags[0] != "localhost:5000/app:abc123" || tags[1] != "localhost:5000/app:latest" {
+		t.Errorf("Tags should have been localhost:5000/app:abc123 and localhost:5000/app:latest, got %v", tags)
+	}
+}
+
+func TestStopTimeout(t *testing.T) {
+	// Nothing configured
+	s := StopParameters{}
+	if s.timeout(-1) != -1 || s.timeout(5) != 5 {
+		t.Errorf("Timeout should have been unset unless overridden, got %v and %v", s.timeout(-1), s.timeout(5))
+	}
+	// Configured timeout
+	timeout := 30
+	s = StopParameters{Timeout: &timeout}
+	if s.timeout(-1) != 30 || s.timeout(0) != 0 {
+		t.Errorf("Timeout should have been 30 unless overridden, got %v and %v", s.timeout(-1), s.timeout(0))
+	}
+	// Configured timeout of 0
+	s = unmarshalYAML([]byte("containers:\n  a:\n    stop:\n      timeout: 0\n")).RawContainerMap["a"].StopParams
+	if s.timeout(-1) != 0 || s.timeout(5) != 5 {
+		t.Errorf("Timeout should have been 0 unless overridden, got %v and %v", s.timeout(-1), s.timeout(5))
+	}
+}
+
+func TestNamedVolumes(t *testing.T) {
+	os.Clearenv()
+	c := &container{
+		RunParams: RunParameters{RawVolume: []string{"data:/var/lib/mysql", "conf:/etc/mysql", "/b"}},
+		volumeMap: VolumeMap{"data": &volume{resource{RawName: "data"}}},
+	}
+	dir, _ := os.Getwd()
+	expected := []string{"data:/var/lib/mysql", dir + "/conf:/etc/mysql", "/b"}
+	if volumes := c.Volumes(); !reflect.DeepEqual(volumes, expected) {
+		t.Errorf("Volumes should have been %v, got %v", expected, volumes)
+	}
+	if names := c.NamedVolumes(); !reflect.DeepEqual(names, []string{"data"}) {
+		t.Errorf("Named volumes should have been [data], got %v", names)
+	}
+}
+
+func TestRunArgs(t *testing.T) {
+	os.Clearenv()
+	c := &container{
+		RawName:   "test",
+		RawImage:  "golang",
+		RunParams: RunParameters{Rm: true, RawEnv: []string{"A=1"}, RawCmd: []interface{}{"go", "test"}},
+		labels:    []string{"crane.project=p"},
+	}
+	expected := []string{"run", "--env", "A=1", "--rm", "--label", "crane.project=p", "--label", "crane.definition=" + c.Definition(), "--name", "test-1", "golang", "go", "test"}
+	if args := c.runArgs("test-1"); !reflect.DeepEqual(args, expected) {
+		t.Errorf("Run arguments should have been %v, got %v", expected, args)
+	}
+	expected = append(append(append([]string{}, expected[:8]...), "--label", "crane.kind=task"), expected[8:]...)
+	if args := c.runArgs("test-1", "crane.kind=task"); !reflect.DeepEqual(args, expected) {
+		t.Errorf("Run arguments should have been %v, got %v", expected, args)
+	}
+}
+
+func TestDefinition(t *testing.T) {
+	os.Clearenv()
+	c := &container{RawName: "a", RawImage: "nginx", RunParams: RunParameters{RawPublish: []string{"80:80"}}}
+	other := &container{RawName: "b", RawImage: "nginx", RunParams: RunParameters{RawPublish: []string{"80:80"}}}
+	if c.Definition() != other.Definition() {
+		t.Errorf("Definitions should not depend on the name, got %s and %s", c.Definition(), other.Definition())
+	}
+	// neither the labels nor the directory crane is run from matter
+	other.labels = []string{"crane.config=/elsewhere/crane.yml"}
+	c.RunParams.RawVolume = []string{"src:/src"}
+	other.RunParams.RawVolume = []string{"src:/src"}
+	if c.Definition() != other.Definition() || !strings.Contains(c.Definition(), `"volume":["src:/src"]`) {
+		t.Errorf("Definitions should not depend on the labels or the cwd, got %s and %s", c.Definition(), other.Definition())
+	}
+	other.RunParams.RawPublish = []string{"8080:80"}
+	other.RunParams.Detach = true
+	if c.Definition() == other.Definition() {
+		t.Errorf("Definitions should have changed with the published ports, got %s twice", c.Definition())
+	}
+	var previous map[string][]string
+	if err := json.Unmarshal([]byte(c.Definition()), &previous); err != nil {
+		t.Fatalf("Definition should have been JSON, got %s", c.Definition())
+	}
+	expected := []FieldDiff{{"detach", []string{"true"}, nil}, {"publish", []string{"8080:80"}, []string{"80:80"}}}
+	if changes := definitionChanges(other.definition(), previous); !reflect.DeepEqual(changes, expected) {
+		t.Errorf("Changes should have been %v, got %v", expected, changes)
+	}
+}
+
+func TestPullImageOnce(t *testing.T) {
+	c := &container{RawName: "a", RawImage: "nginx", RawPull: PullAlways}
+	pulledImages["nginx"] = true
+	defer delete(pulledImages, "nginx")
+	// would fail without docker if it pulled again
+	if !c.pullBeforeRun() {
+		t.Errorf("Container should have been allowed to run")
+	}
+}
+
+func TestVolumeDestinations(t *testing.T) {
+	var mounts []Mount
+	json.Unmarshal([]byte(`[{"Type":"bind","Source":"/home/app","Destination":"/app"},{"Type":"volume","Name":"data","Destination":"/data"},{"Type":"volume","Destination":"/cache"}]`), &mounts)
+	if destinations := volumeDestinations(mounts); !reflect.DeepEqual(destinations, []string{"/data", "/cache"}) {
+		t.Errorf("Destinations should have been [/data /cache], got %v", destinations)
+	}
+	if destinations := volumeDestinations(mounts[:1]); destinations != nil {
+		t.Errorf("Bind mounts should not be volumes, got %v", destinations)
+	}
+}
+
+func TestHelperMount(t *testing.T) {
+	examples := []struct {
+		destinations []string
+		expected     string
+	}{
+		{[]string{"/backup", "/var/lib/my data"}, "/crane-backup"},
+		{[]string{"/crane-backup"}, "/crane-backup-1"},
+		{[]string{"/crane-backup/data", "/crane-backup-1"}, "/crane-backup-2"},
+	}
+	for _, example := range examples {
+		var mounts []Mount
+		for _, destination := range example.destinations {
+			mounts = append(mounts, Mount{"volume", destination})
+		}
+		if mount := helperMount(mounts); mount != example.expected {
+			t.Errorf("Mount for %v should have been %s, got %s", example.destinations, example.expected, mount)
+		}
+	}
+}
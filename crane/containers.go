@@ -3,8 +3,10 @@ package crane
 import (
 	"fmt"
 	"os"
+	"sort"
 	"strings"
 	"text/tabwriter"
+	"time"
 )
 
 type Containers []Container
@@ -28,9 +30,9 @@ func (containers Containers) reversed() Containers {
 // Lift containers (provision + run).
 // When recreate is set, this will re-provision all images
 // and recreate all containers.
-func (containers Containers) lift(recreate bool, nocache bool) {
+func (containers Containers) lift(recreate bool, nocache bool, timeout int) {
 	containers.provisionOrSkip(recreate, nocache)
-	containers.runOrStart(recreate)
+	containers.runOrStart(recreate, timeout)
 }
 
 // Provision containers.
@@ -42,9 +44,9 @@ func (containers Containers) provision(nocache bool) {
 
 // Run containers.
 // When recreate is true, removes existing containers first.
-func (containers Containers) run(recreate bool) {
+func (containers Containers) run(recreate bool, timeout int) {
 	if recreate {
-		containers.rm(true)
+		containers.rm(true, timeout)
 	}
 	for _, container := range containers {
 		container.Run()
@@ -53,15 +55,114 @@ func (containers Containers) run(recreate bool) {
 
 // Run or start containers.
 // When recreate is true, removes existing containers first.
-func (containers Containers) runOrStart(recreate bool) {
+func (containers Containers) runOrStart(recreate bool, timeout int) {
 	if recreate {
-		containers.rm(true)
+		containers.rm(true, timeout)
 	}
 	for _, container := range containers {
 		container.RunOrStart()
 	}
 }
 
+// Run the task of the given name after lifting the
+// other containers, which are its dependencies.
+func (containers Containers) do(name string, args []string) {
+	var task Container
+	var dependencies Containers
+	for _, container := range containers {
+		if container.Name() == name {
+			task = container
+		} else {
+			dependencies = append(dependencies, container)
+		}
+	}
+	dependencies.lift(false, false, -1)
+	task.ProvisionOrSkip(false, false)
+	task.RunTask(args)
+}
+
+// affectedContainers returns the container of the given name, followed by
+// the existing containers depending on it through the given kind, directly
+// or not, in dependency order. Tasks are left out.
+func affectedContainers(config Config, name string, kind string) Containers {
+	containerMap := config.ContainerMap()
+	names := []string{}
+	for dependent := range containerMap {
+		names = append(names, dependent)
+	}
+	sort.Strings(names)
+	included := Target{name}
+	for seeds := []string{name}; len(seeds) > 0; {
+		nextSeeds := []string{}
+		for _, seed := range seeds {
+			for _, dependent := range names {
+				container := containerMap[dependent]
+				if !included.includes(dependent) && container.Kind() != KindTask && container.Dependencies().includesAsKind(seed, kind) && container.Exists() {
+					included = append(included, dependent)
+					nextSeeds = append(nextSeeds, dependent)
+				}
+			}
+		}
+		seeds = nextSeeds
+	}
+	order, err := config.DependencyGraph().order(included, true)
+	if err != nil {
+		// keep the order in which they were found
+		order = []string{}
+		for _, name := range included {
+			order = append([]string{name}, order...)
+		}
+	}
+	var containers Containers
+	for _, name := range order {
+		containers = append(Containers{containerMap[name]}, containers...)
+	}
+	return containers
+}
+
+// linkDependents returns the existing containers linking to the container
+// of the given name through legacy links, directly or not, in dependency
+// order. They need to be recreated when the container gets replaced.
+func linkDependents(config Config, name string) Containers {
+	var dependents Containers
+	for _, container := range affectedContainers(config, name, "link")[1:] {
+		if container.LegacyLinks() {
+			dependents = append(dependents, container)
+		}
+	}
+	return dependents
+}
+
+// Update containers one after the other, in dependency order,
+// pausing the given number of seconds in between. When rolling
+// is true, each container is replaced without downtime, and the
+// containers linking to it are recreated afterwards.
+func (containers Containers) update(config Config, rolling bool, nocache bool, timeout int, wait int, pause int) {
+	if !rolling {
+		containers.lift(true, nocache, timeout)
+		return
+	}
+	var problems []string
+	for _, container := range containers {
+		if err := container.RollingUpdateError(); err != nil {
+			problems = append(problems, err.Error())
+		}
+	}
+	if len(problems) > 0 {
+		panic(StatusError{fmt.Errorf("Cannot update without downtime:\n  %s", strings.Join(problems, "\n  ")), 78})
+	}
+	for i, container := range containers {
+		if i > 0 && pause > 0 {
+			time.Sleep(time.Duration(pause) * time.Second)
+		}
+		container.ProvisionOrSkip(true, nocache)
+		container.Update(timeout, wait)
+		dependents := linkDependents(config, container.Name())
+		dependents.reversed().rm(true, timeout)
+		dependents.run(false, timeout)
+	}
+}
+
 // Provision or skip images.
 // When update is true, provisions all images.
 func (containers Containers) provisionOrSkip(update bool, nocache bool) {
@@ -85,9 +186,25 @@ func (containers Containers) kill() {
 }
 
 // Stop containers.
-func (containers Containers) stop() {
+// A non-negative timeout overrides the configured ones.
+func (containers Containers) stop(timeout int) {
+	for _, container := range containers {
+		container.Stop(timeout)
+	}
+}
+
+// Restart containers.
+// Containers are stopped in reverse order first, and then
+// started again in order.
+func (containers Containers) restart(timeout int) {
+	containers.reversed().stop(timeout)
+	containers.start()
+}
+
+// Terminate containers.
+func (containers Containers) terminate(timeout int) {
 	for _, container := range containers {
-		container.Stop()
+		container.Terminate(timeout)
 	}
 }
 
@@ -106,14 +223,51 @@ func (containers Containers) unpause() {
 }
 
 // Remove containers.
-// When kill is true, kills existing containers first.
-func (containers Containers) rm(kill bool) {
+// When kill is true, terminates existing containers first.
+func (containers Containers) rm(kill bool, timeout int) {
+	if kill {
+		containers.terminate(timeout)
+	}
+	for _, container := range containers {
+		container.Rm(false)
+	}
+}
+
+// Tear down containers.
+// Containers are stopped (or killed if kill is true) and removed,
+// along with the networks crane created for them.
+// When volumes is true, their volumes (including the named ones
+// declared in the config) are removed as well, and
+// when images is true, the images built from Dockerfiles too.
+func (containers Containers) down(kill bool, volumes bool, images bool, timeout int) {
 	if kill {
 		containers.kill()
+	} else {
+		containers.stop(timeout)
+	}
+	for _, container := range containers {
+		container.Rm(volumes)
 	}
 	for _, container := range containers {
-		container.Rm()
+		container.RmNetworks()
+		if volumes {
+			container.RmNamedVolumes()
+		}
 	}
+	if images {
+		for _, container := range containers {
+			container.RmImage()
+		}
+	}
+}
+
+// Prune containers: kill and remove them.
+func (containers Containers) prune() {
+	if len(containers) == 0 {
+		fmt.Println("No orphaned containers found.")
+		return
+	}
+	containers.rm(true, -1)
 }
 
 // Push containers.
@@ -138,6 +292,46 @@ func (containers Containers) status(notrunc bool) {
 	w.Flush()
 }
 
+// Differences between the config and the live containers.
+func (containers Containers) diff() {
+	for _, container := range containers {
+		displayDiff(os.Stdout, container.Name(), container.Exists(), container.Diff())
+	}
+}
+
+// Targets of the command, in order.
+// When explain is true, the reason each container
+// was targeted for is displayed as well.
+func (containers Containers) targets(reasons map[string]string, explain bool) {
+	if !explain {
+		for _, name := range containers.names() {
+			fmt.Println(name)
+		}
+		return
+	}
+	w := new(tabwriter.Writer)
+	w.Init(os.Stdout, 0, 8, 1, '\t', 0)
+	fmt.Fprintln(w, "NAME\tREASON")
+	for _, name := range containers.names() {
+		fmt.Fprintf(w, "%s\t%s\n", name, reasons[name])
+	}
+	w.Flush()
+}
+
+// namedVolumes returns the names of the declared
+// named volumes used by the containers
+func (containers Containers) namedVolumes() []string {
+	var names []string
+	for _, container := range containers {
+		for _, name := range container.NamedVolumes() {
+			if !Target(names).includes(name) {
+				names = append(names, name)
+			}
+		}
+	}
+	return names
+}
+
 func truncateID(id string) string {
 	shortLen := 12
 	if len(id) < shortLen {
@@ -1,6 +1,10 @@
 package crane
 
-import "testing"
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
 
 func TestNames(t *testing.T) {
 	var containers Containers
@@ -19,3 +23,116 @@ func TestReversed(t *testing.T) {
 		t.Errorf("Containers should have been ordered [b a], got %v", reversed)
 	}
 }
+
+// Container stub recording the calls made to it
+type RecordingContainer struct {
+	Container
+	calls *[]string
+}
+
+func (c *RecordingContainer) Stop(timeout int) {
+	*c.calls = append(*c.calls, "stop "+c.Name())
+}
+
+func (c *RecordingContainer) Start() {
+	*c.calls = append(*c.calls, "start "+c.Name())
+}
+
+func (c *RecordingContainer) ProvisionOrSkip(update bool, nocache bool) {
+	*c.calls = append(*c.calls, "provision "+c.Name())
+}
+
+func (c *RecordingContainer) RunOrStart() {
+	*c.calls = append(*c.calls, "run "+c.Name())
+}
+
+func (c *RecordingContainer) RunTask(args []string) {
+	*c.calls = append(*c.calls, "task "+c.Name()+" "+strings.Join(args, " "))
+}
+
+func (c *RecordingContainer) Update(timeout int, wait int) {
+	*c.calls = append(*c.calls, "update "+c.Name())
+}
+
+func TestRestart(t *testing.T) {
+	var calls []string
+	containers := Containers{
+		&RecordingContainer{&container{RawName: "a"}, &calls},
+		&RecordingContainer{&container{RawName: "b"}, &calls},
+	}
+	containers.restart(-1)
+	expected := []string{"stop b", "stop a", "start a", "start b"}
+	if !reflect.DeepEqual(calls, expected) {
+		t.Errorf("Calls should have been %v, got %v", expected, calls)
+	}
+}
+
+func TestDo(t *testing.T) {
+	var calls []string
+	containers := Containers{
+		&RecordingContainer{&container{RawName: "db"}, &calls},
+		&RecordingContainer{&container{RawName: "test"}, &calls},
+	}
+	containers.do("test", []string{"-v", "./..."})
+	expected := []string{"provision db", "run db", "provision test", "task test -v ./..."}
+	if !reflect.DeepEqual(calls, expected) {
+		t.Errorf("Calls should have been %v, got %v", expected, calls)
+	}
+}
+
+func TestRollingUpdate(t *testing.T) {
+	var calls []string
+	containers := Containers{
+		&RecordingContainer{&container{RawName: "db", RunParams: RunParameters{Detach: true}}, &calls},
+		&RecordingContainer{&container{RawName: "web", RunParams: RunParameters{Detach: true, RawPublish: []string{"80"}}}, &calls},
+	}
+	config := &config{containerMap: ContainerMap{"db": containers[0], "web": containers[1]}}
+	containers.update(config, true, false, -1, 60, 0)
+	expected := []string{"provision db", "update db", "provision web", "update web"}
+	if !reflect.DeepEqual(calls, expected) {
+		t.Errorf("Calls should have been %v, got %v", expected, calls)
+	}
+	// Containers which cannot be updated without downtime are refused upfront
+	calls = nil
+	containers = append(containers, &RecordingContainer{&container{RawName: "proxy", RunParams: RunParameters{Detach: true, RawPublish: []string{"80:80"}}}, &calls})
+	defer func() {
+		if recover() == nil || len(calls) > 0 {
+			t.Errorf("Container publishing a fixed host port should have caused a panic before any update, got %v", calls)
+		}
+	}()
+	containers.update(config, true, false, -1, 60, 0)
+}
+
+func TestRollingUpdateError(t *testing.T) {
+	for _, c := range []*container{
+		&container{RawName: "a"},
+		&container{RawName: "a", RunParams: RunParameters{Detach: true, RawCidfile: "a.cid"}},
+		&container{RawName: "a", RunParams: RunParameters{Detach: true, RawPublish: []string{"127.0.0.1:8080:80"}}},
+	} {
+		if c.RollingUpdateError() == nil {
+			t.Errorf("Container %v should not have been updatable without downtime", c.RunParams)
+		}
+	}
+	c := &container{RawName: "a", RunParams: RunParameters{Detach: true, RawPublish: []string{"80", "127.0.0.1::443"}}}
+	if err := c.RollingUpdateError(); err != nil {
+		t.Errorf("Container should have been updatable without downtime, got %s", err)
+	}
+}
+
+func TestLinkDependents(t *testing.T) {
+	c := &config{containerMap: NewStubbedContainerMap(true,
+		&container{RawName: "db"},
+		&container{RawName: "app", RunParams: RunParameters{RawLink: []string{"db:db"}}},
+		&container{RawName: "web", RunParams: RunParameters{RawLink: []string{"app:app"}}},
+		&container{RawName: "backup", RunParams: RunParameters{RawVolumesFrom: []string{"db"}}},
+	)}
+	if names := linkDependents(c, "db").names(); !reflect.DeepEqual(names, []string{"app", "web"}) {
+		t.Errorf("Link dependents should have been app and web, got %v", names)
+	}
+	for _, stub := range c.containerMap {
+		stub.(*StubbedContainer).Container.(*container).sharedNetwork = "p_default"
+	}
+	if dependents := linkDependents(c, "db"); len(dependents) != 0 {
+		t.Errorf("There should have been no link dependents with network aliases, got %v", dependents.names())
+	}
+}
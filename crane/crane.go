@@ -41,10 +41,17 @@ func RealMain() {
 }
 
 func executeCommand(name string, args []string) {
+	executeCommandIn("", name, args)
+}
+
+// executeCommandIn executes the command in the given
+// directory, or in the current one if dir is empty
+func executeCommandIn(dir string, name string, args []string) {
 	if isVerbose() {
 		fmt.Printf("\n--> %s %s\n", name, strings.Join(args, " "))
 	}
 	cmd := exec.Command(name, args...)
+	cmd.Dir = dir
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
 	cmd.Stdin = os.Stdin
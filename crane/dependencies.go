@@ -1,5 +1,9 @@
 package crane
 
+import (
+	"strings"
+)
+
 // Dependencies contains 4 fields:
 // all: contains all dependencies
 // link: containers linked to
@@ -30,8 +34,19 @@ func (d *Dependencies) includesAsKind(needle string, kind string) bool {
 }
 
 // returns the list of dependencies for a certain
-// kind of dependency
+// kind of dependency, or several comma-separated ones
 func (d *Dependencies) forKind(kind string) []string {
+	if strings.Contains(kind, ",") {
+		dependencies := []string{}
+		for _, k := range strings.Split(kind, ",") {
+			for _, name := range d.forKind(k) {
+				if len(name) > 0 && !Target(dependencies).includes(name) {
+					dependencies = append(dependencies, name)
+				}
+			}
+		}
+		return dependencies
+	}
 	switch kind {
 	case "all":
 		return d.All
@@ -46,6 +61,17 @@ func (d *Dependencies) forKind(kind string) []string {
 	}
 }
 
+// kind returns the kind of dependency the given
+// needle is, i.e. link, volumesFrom or net
+func (d *Dependencies) kind(needle string) string {
+	for _, kind := range []string{"link", "volumesFrom", "net"} {
+		if d.includesAsKind(needle, kind) {
+			return kind
+		}
+	}
+	return "unknown"
+}
+
 // mustRun checks whether the given needle needs
 // to be running
 func (d *Dependencies) mustRun(needle string) bool {
@@ -59,18 +85,3 @@ func (d *Dependencies) mustRun(needle string) bool {
 	}
 	return false
 }
-
-// satisfied is true when there are no
-// dependencies
-func (d *Dependencies) satisfied() bool {
-	return len(d.All) == 0
-}
-
-// remove removes the given name from all
-func (d *Dependencies) remove(resolved string) {
-	for i, name := range d.All {
-		if name == resolved {
-			d.All = append(d.All[:i], d.All[i+1:]...)
-		}
-	}
-}
@@ -148,20 +148,33 @@ func TestForKind(t *testing.T) {
 
 }
 
-func TestSatisfied(t *testing.T) {
-	var dependencies Dependencies
-
-	dependencies = Dependencies{
-		All: []string{"a"},
+func TestKind(t *testing.T) {
+	dependencies := Dependencies{
+		All:         []string{"link", "volumesFrom", "net"},
+		Link:        []string{"link"},
+		VolumesFrom: []string{"volumesFrom"},
+		Net:         "net",
 	}
-	if dependencies.satisfied() {
-		t.Errorf("Dependencies was not empty, but appeared to be satisfied")
+	for _, kind := range []string{"link", "volumesFrom", "net"} {
+		if dependencies.kind(kind) != kind {
+			t.Errorf("Kind of %s should have been %s, got %s", kind, kind, dependencies.kind(kind))
+		}
 	}
+	if dependencies.kind("non-existant") != "unknown" {
+		t.Errorf("Kind of non-existant should have been unknown, got %s", dependencies.kind("non-existant"))
+	}
+}
 
-	dependencies = Dependencies{
-		All: []string{},
+func TestForSeveralKinds(t *testing.T) {
+	dependencies := Dependencies{
+		All:         []string{"link", "volumesFrom"},
+		Link:        []string{"link"},
+		VolumesFrom: []string{"volumesFrom"},
+	}
+	if kindDeps := dependencies.forKind("link,net,volumesFrom"); !reflect.DeepEqual(kindDeps, []string{"link", "volumesFrom"}) {
+		t.Errorf("[link volumesFrom] expected, got %v", kindDeps)
 	}
-	if !dependencies.satisfied() {
-		t.Errorf("Dependencies was empty, but appeared not to be satisfied")
+	if !dependencies.includesAsKind("volumesFrom", "link,volumesFrom") || dependencies.includesAsKind("volumesFrom", "link,net") {
+		t.Errorf("volumesFrom should have been included as link,volumesFrom only")
 	}
 }
@@ -1,9 +1,12 @@
 package crane
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/michaelsauter/crane/print"
 	"io"
+	"sort"
 	"strings"
 	"text/template"
 )
@@ -13,122 +16,436 @@ import (
 type DependencyGraph map[string]*Dependencies
 
 type dotInput struct {
-	Graph DependencyGraph
+	Graph              DependencyGraph
 	TargetedContainers Containers
+	DOTOptions
+}
+
+// DOTOptions holds the optional information to render in the DOT output
+type DOTOptions struct {
+	// States maps container names to their current state
+	States map[string]*ContainerState
+	// Groups are rendered as clusters
+	Groups map[string][]string
+}
+
+// ContainerState describes the current state of a container
+// for the DOT output
+type ContainerState struct {
+	State         string
+	ImageOutdated bool
+}
+
+// Color returns the fill color for the state
+func (s *ContainerState) Color() string {
+	switch s.State {
+	case "running":
+		return "palegreen"
+	case "stopped":
+		return "gold"
+	default:
+		return "lightgrey"
+	}
+}
+
+// containerStates looks up the states of the given containers
+func containerStates(containerMap ContainerMap) map[string]*ContainerState {
+	states := make(map[string]*ContainerState)
+	for name, container := range containerMap {
+		state := &ContainerState{State: "missing"}
+		if container.Running() {
+			state.State = "running"
+		} else if container.Exists() {
+			state.State = "stopped"
+		}
+		state.ImageOutdated = container.ImageOutdated()
+		states[name] = state
+	}
+	return states
 }
 
 // dumps the dependency graph as a DOT to the writer
-func (graph DependencyGraph) DOT(writer io.Writer, targetedContainers Containers) {
-	const dotTemplate = `{{ $targetedContainers := .TargetedContainers }}digraph {
-{{ range $name, $dependencies := .Graph }}{{ with $dependencies }}  "{{ $name }}" [style=bold{{ range $targetedContainers }}{{ if eq $name .Name }},color=red{{ end }}{{ end }}]
+func (graph DependencyGraph) DOT(writer io.Writer, targetedContainers Containers, options DOTOptions) {
+	const dotTemplate = `{{ $targetedContainers := .TargetedContainers }}{{ $states := .States }}digraph {
+{{ range $name, $dependencies := .Graph }}{{ with $dependencies }}  "{{ $name }}" [style={{ with index $states $name }}"bold,filled",fillcolor={{ .Color }}{{ if .ImageOutdated }},label="{{ $name }}\n(outdated image)"{{ end }}{{ else }}bold{{ end }}{{ range $targetedContainers }}{{ if eq $name .Name }},color=red{{ end }}{{ end }}]
 {{ range .Link }}  "{{ $name }}"->"{{ . }}"
 {{ end }}{{ range .VolumesFrom }}  "{{ $name }}"->"{{ . }}" [style=dashed]
 {{ end }}{{ if ne .Net "" }}  "{{ $name }}"->"{{ .Net }}" [style=dotted]
-{{ end }}{{ end }}{{ end }}}`
+{{ end }}{{ end }}{{ end }}{{ range $group, $names := .Groups }}  subgraph "cluster_{{ $group }}" {
+    label="{{ $group }}"
+{{ range $names }}    "{{ . }}"
+{{ end }}  }
+{{ end }}}`
 	template, err := template.New("dot").Parse(dotTemplate)
 	if err != nil {
 		print.Errorf("ERROR: %s\n", err)
 		return
 	}
-	err = template.Execute(writer, dotInput{graph, targetedContainers})
+	options.Groups = clusters(options.Groups)
+	err = template.Execute(writer, dotInput{graph, targetedContainers, options})
 	if err != nil {
 		print.Errorf("ERROR: %s\n", err)
 	}
 }
 
-// determineOrder works on the dependency graph and returns the order
-// of the given the target (a subset of the graph).
+// clusters assigns each container to the first of its groups
+// by name, as a node can only be part of one cluster. Groups
+// left without containers are dropped.
+func clusters(groups map[string][]string) map[string][]string {
+	if groups == nil {
+		return nil
+	}
+	names := []string{}
+	for name := range groups {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	clustered := make(map[string]bool)
+	result := make(map[string][]string)
+	for _, name := range names {
+		for _, container := range groups[name] {
+			if !clustered[container] {
+				clustered[container] = true
+				result[name] = append(result[name], container)
+			}
+		}
+	}
+	return result
+}
+
+// graphEdge is a dependency between two containers
+type graphEdge struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+	Kind string `json:"kind"`
+}
+
+// graphNode is a container of the dependency graph
+type graphNode struct {
+	Name     string `json:"name"`
+	Declared bool   `json:"declared"`
+	Targeted bool   `json:"targeted"`
+}
+
+// nodes returns all containers of the graph sorted by name, including
+// the ones which are referenced but not declared
+func (graph DependencyGraph) nodes(targetedContainers Containers) []graphNode {
+	names := make(map[string]bool)
+	for name := range graph {
+		names[name] = true
+	}
+	for _, edge := range graph.edges() {
+		names[edge.To] = true
+	}
+	targeted := Target(targetedContainers.names())
+	var nodes []graphNode
+	for _, name := range sortedKeys(names) {
+		_, declared := graph[name]
+		nodes = append(nodes, graphNode{name, declared, targeted.includes(name)})
+	}
+	return nodes
+}
+
+// edges returns all dependencies of the graph, sorted by
+// dependent container, then by kind
+func (graph DependencyGraph) edges() []graphEdge {
+	var edges []graphEdge
+	for _, name := range graph.names() {
+		dependencies := graph[name]
+		for _, link := range dependencies.Link {
+			edges = append(edges, graphEdge{name, link, "link"})
+		}
+		for _, volumesFrom := range dependencies.VolumesFrom {
+			edges = append(edges, graphEdge{name, volumesFrom, "volumesFrom"})
+		}
+		if dependencies.Net != "" {
+			edges = append(edges, graphEdge{name, dependencies.Net, "net"})
+		}
+	}
+	return edges
+}
+
+// names returns the declared containers sorted by name
+func (graph DependencyGraph) names() []string {
+	names := make(map[string]bool)
+	for name := range graph {
+		names[name] = true
+	}
+	return sortedKeys(names)
+}
+
+// dumps the dependency graph as JSON to the writer
+func (graph DependencyGraph) JSON(writer io.Writer, targetedContainers Containers) {
+	data := struct {
+		Containers []graphNode `json:"containers"`
+		Edges      []graphEdge `json:"edges"`
+	}{graph.nodes(targetedContainers), graph.edges()}
+	if data.Edges == nil {
+		data.Edges = []graphEdge{}
+	}
+	output, err := json.MarshalIndent(data, "", "  ")
+	if err != nil {
+		print.Errorf("ERROR: %s\n", err)
+		return
+	}
+	fmt.Fprintf(writer, "%s\n", output)
+}
+
+// dumps the dependency graph as a Mermaid flowchart to the writer
+func (graph DependencyGraph) Mermaid(writer io.Writer, targetedContainers Containers) {
+	arrows := map[string]string{"link": "-->", "volumesFrom": "-.->", "net": "==>"}
+	ids := make(map[string]string)
+	fmt.Fprintln(writer, "graph TD")
+	for i, node := range graph.nodes(targetedContainers) {
+		ids[node.Name] = fmt.Sprintf("n%d", i)
+		fmt.Fprintf(writer, "  %s[\"%s\"]\n", ids[node.Name], node.Name)
+		if node.Declared {
+			fmt.Fprintf(writer, "  class %s declared\n", ids[node.Name])
+		}
+		if node.Targeted {
+			fmt.Fprintf(writer, "  class %s targeted\n", ids[node.Name])
+		}
+	}
+	for _, edge := range graph.edges() {
+		fmt.Fprintf(writer, "  %s %s|%s| %s\n", ids[edge.From], arrows[edge.Kind], edge.Kind, ids[edge.To])
+	}
+	fmt.Fprintln(writer, "  classDef declared font-weight:bold")
+	fmt.Fprintln(writer, "  classDef targeted stroke:red")
+}
+
+// dumps the dependency graph as an ASCII tree to the writer,
+// starting from the containers no other container depends on,
+// followed by the ones only reachable through cycles.
+// Targeted containers are marked with a star.
+func (graph DependencyGraph) Tree(writer io.Writer, targetedContainers Containers) {
+	targeted := Target(targetedContainers.names())
+	children := make(map[string][]graphEdge)
+	dependedOn := make(map[string]bool)
+	for _, edge := range graph.edges() {
+		children[edge.From] = append(children[edge.From], edge)
+		dependedOn[edge.To] = true
+	}
+	label := func(name string) string {
+		if targeted.includes(name) {
+			return name + " *"
+		}
+		return name
+	}
+	printed := make(map[string]bool)
+	var printChildren func(name string, prefix string, path []string)
+	printChildren = func(name string, prefix string, path []string) {
+		printed[name] = true
+		for i, edge := range children[name] {
+			branch, indent := "├── ", "│   "
+			if i == len(children[name])-1 {
+				branch, indent = "└── ", "    "
+			}
+			if Target(path).includes(edge.To) {
+				fmt.Fprintf(writer, "%s%s%s (%s, cycle)\n", prefix, branch, label(edge.To), edge.Kind)
+				continue
+			}
+			fmt.Fprintf(writer, "%s%s%s (%s)\n", prefix, branch, label(edge.To), edge.Kind)
+			printChildren(edge.To, prefix+indent, append(path, edge.To))
+		}
+	}
+	for _, name := range graph.names() {
+		if !dependedOn[name] {
+			fmt.Fprintln(writer, label(name))
+			printChildren(name, "", []string{name})
+		}
+	}
+	for _, name := range graph.names() {
+		if !printed[name] {
+			fmt.Fprintln(writer, label(name))
+			printChildren(name, "", []string{name})
+		}
+	}
+}
+
+// sortedKeys returns the keys of the given set sorted
+func sortedKeys(set map[string]bool) []string {
+	keys := []string{}
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// order works on the dependency graph and returns the order
+// of the given the target (a subset of the graph), dependent
+// containers coming first.
+// The graph is left untouched, and the order is deterministic:
+// when several containers could come next, the one with the
+// smallest name is started first.
 // If force is true, the map will be ordered even if dependencies
 // are missing.
 // If force is false and the graph cannot be resolved properly,
 // an error is returned.
 func (graph DependencyGraph) order(target Target, force bool) (order []string, err error) {
-	success := true
-	for success && len(order) < len(target) {
-		success = false
-
-		// Try to resolve container with satisfied dependencies
-		for _, name := range target {
-			if dependencies, ok := graph[name]; ok {
-				if dependencies.satisfied() {
-					// Resolve "name" and continue with next iteration
-					success = true
-					order = append([]string{name}, order...)
-					graph.resolve(name)
-					break
-				}
-			}
-		}
+	sortedTarget := append(Target{}, target...)
+	sort.Strings(sortedTarget)
+	resolved := make(map[string]bool)
+	satisfied := graph.satisfiedFunc(target, resolved, force)
 
-		// If we could not resolve a container so far in this iteration,
-		// we check if one of the non-targeted dependencies already runs or exists.
-		if !success {
-			for _, name := range target {
-				if dependencies, ok := graph[name]; ok {
-					for _, name := range dependencies.All {
-						if !target.includes(name) {
-							container := graph.tmpContainer(name)
-							satisfied := false
-							if dependencies.mustRun(name) {
-								satisfied = container.Running()
-							} else {
-								satisfied = container.Exists()
-							}
-							if satisfied {
-								success = true
-								graph.resolve(name)
-								break
-							}
-						}
+	for len(order) < len(target) {
+		next := ""
+		for _, name := range sortedTarget {
+			if dependencies, ok := graph[name]; ok && !resolved[name] {
+				ready := true
+				for _, dependency := range dependencies.All {
+					if !satisfied(dependencies, dependency) {
+						ready = false
+						break
 					}
 				}
-			}
-		}
-
-		// If we still have not resolved a dependency, we can't
-		// order the given target properly. However, if the order
-		// is forced, we just resolve the first non-targeted
-		// dependency.
-		if !success && force {
-			for _, name := range target {
-				if dependencies, ok := graph[name]; ok {
-					for _, name := range dependencies.All {
-						if !target.includes(name) {
-							success = true
-							graph.resolve(name)
-							break
-						}
-					}
+				if ready {
+					next = name
+					break
 				}
 			}
 		}
+		if next == "" {
+			break
+		}
+		resolved[next] = true
+		order = append([]string{next}, order...)
 	}
 
 	// If we the order is not complete yet, the target
 	// cannot be resolved (cyclic or missing dependency found).
 	if len(order) < len(target) {
 		unresolved := []string{}
-		for _, name := range target {
-			if _, ok := graph[name]; ok {
+		for _, name := range sortedTarget {
+			if !resolved[name] {
 				unresolved = append(unresolved, name)
 			}
 		}
-		err = fmt.Errorf("Dependencies for container(s) %s could not be resolved. Check for cyclic or missing dependencies, or use -d/--cascade-dependencies to automatically attempt to recursively include dependencies in the set of targeted containers.", strings.Join(unresolved, ", "))
+		err = graph.unresolvableError(unresolved, target, satisfied)
 	}
 
 	return
 }
 
-func (d DependencyGraph) tmpContainer(name string) Container {
-	return &container{RawName: name}
+// satisfiedFunc returns a function telling whether the given dependency
+// of a container is satisfied: targeted dependencies must be resolved
+// already, while non-targeted ones must be running (or exist, depending
+// on the kind of dependency), unless force is true.
+// The state of non-targeted containers is looked up only once.
+func (graph DependencyGraph) satisfiedFunc(target Target, resolved map[string]bool, force bool) func(dependencies *Dependencies, name string) bool {
+	running := make(map[string]bool)
+	exists := make(map[string]bool)
+	return func(dependencies *Dependencies, name string) bool {
+		if target.includes(name) {
+			return resolved[name]
+		}
+		if force {
+			return true
+		}
+		if dependencies.mustRun(name) {
+			if _, ok := running[name]; !ok {
+				running[name] = graph.tmpContainer(name).Running()
+			}
+			return running[name]
+		}
+		if _, ok := exists[name]; !ok {
+			exists[name] = graph.tmpContainer(name).Exists()
+		}
+		return exists[name]
+	}
+}
+
+// unresolvableError builds the error describing why the unresolved
+// containers of the target could not be ordered, distinguishing
+// cyclic dependencies from missing ones.
+func (graph DependencyGraph) unresolvableError(unresolved []string, target Target, satisfied func(dependencies *Dependencies, name string) bool) error {
+	message := fmt.Sprintf("Dependencies for container(s) %s could not be resolved.", strings.Join(unresolved, ", "))
+	if cycle := graph.cycle(unresolved); len(cycle) > 0 {
+		message += "\nCyclic dependency found: " + graph.formatPath(cycle)
+	}
+	missing := false
+	for _, name := range unresolved {
+		dependencies, ok := graph[name]
+		if !ok {
+			continue
+		}
+		for _, dependency := range dependencies.All {
+			if target.includes(dependency) || satisfied(dependencies, dependency) {
+				continue
+			}
+			missing = true
+			reason := "not declared"
+			if _, declared := graph[dependency]; declared {
+				if dependencies.mustRun(dependency) {
+					reason = "not targeted and not running"
+				} else {
+					reason = "not targeted and not existing"
+				}
+			}
+			message += fmt.Sprintf("\nMissing dependency: %s (%s), referenced by %s via %s", dependency, reason, name, dependencies.kind(dependency))
+		}
+	}
+	if missing {
+		message += "\nUse -d/--cascade-dependencies to automatically attempt to recursively include dependencies in the set of targeted containers."
+	}
+	return errors.New(message)
 }
 
-// resolve deletes the given name from the
-// dependency graph and removes it from all
-// dependencies.
-func (d DependencyGraph) resolve(resolved string) {
-	delete(d, resolved)
-	for _, dependencies := range d {
-		dependencies.remove(resolved)
+// cycle returns a dependency cycle between the given containers as a
+// path starting and ending with the same container, or nil if there
+// is none.
+func (graph DependencyGraph) cycle(names []string) []string {
+	sorted := append([]string{}, names...)
+	sort.Strings(sorted)
+	among := make(map[string]bool)
+	for _, name := range names {
+		among[name] = true
 	}
+	visited := make(map[string]bool)
+	var path []string
+	var visit func(name string) []string
+	visit = func(name string) []string {
+		for i, onPath := range path {
+			if onPath == name {
+				return append(append([]string{}, path[i:]...), name)
+			}
+		}
+		dependencies, ok := graph[name]
+		if visited[name] || !ok || !among[name] {
+			return nil
+		}
+		visited[name] = true
+		path = append(path, name)
+		for _, dependency := range dependencies.All {
+			if cycle := visit(dependency); cycle != nil {
+				return cycle
+			}
+		}
+		path = path[:len(path)-1]
+		return nil
+	}
+	for _, name := range sorted {
+		if cycle := visit(name); cycle != nil {
+			return cycle
+		}
+	}
+	return nil
+}
+
+// formatPath formats a path of containers, annotating each step with
+// the kind of dependency, e.g. `a -link-> b -net-> c`
+func (graph DependencyGraph) formatPath(path []string) string {
+	formatted := path[0]
+	for i := 1; i < len(path); i++ {
+		kind := "?"
+		if dependencies, ok := graph[path[i-1]]; ok {
+			kind = dependencies.kind(path[i])
+		}
+		formatted += fmt.Sprintf(" -%s-> %s", kind, path[i])
+	}
+	return formatted
+}
+
+func (d DependencyGraph) tmpContainer(name string) Container {
+	return &container{RawName: name}
 }
@@ -3,6 +3,7 @@ package crane
 import (
 	"bytes"
 	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -13,7 +14,7 @@ func TestDOT(t *testing.T) {
 		"c": &Dependencies{Net: "d"},
 	}
 	var buffer bytes.Buffer
-	dependencyGraph.DOT(&buffer, Containers{&container{RawName: "a"}, &container{RawName: "b"}})
+	dependencyGraph.DOT(&buffer, Containers{&container{RawName: "a"}, &container{RawName: "b"}}, DOTOptions{})
 	expected := `digraph {
   "a" [style=bold,color=red]
   "a"->"c"
@@ -107,3 +108,200 @@ func TestOrder(t *testing.T) {
 		}
 	}
 }
+
+func TestOrderErrors(t *testing.T) {
+	// cyclic dependencies
+	graph := DependencyGraph{
+		"a": &Dependencies{All: []string{"b"}, Link: []string{"b"}},
+		"b": &Dependencies{All: []string{"c"}, VolumesFrom: []string{"c"}},
+		"c": &Dependencies{All: []string{"a"}, Net: "a"},
+	}
+	_, err := graph.order([]string{"a", "b", "c"}, false)
+	if err == nil || !strings.Contains(err.Error(), "Cyclic dependency found: a -link-> b -volumesFrom-> c -net-> a") {
+		t.Errorf("Error should have contained the cycle, got %v", err)
+	}
+	if strings.Contains(err.Error(), "Missing dependency") {
+		t.Errorf("Error should not have mentioned missing dependencies, got %v", err)
+	}
+	// missing dependencies
+	graph = DependencyGraph{
+		"a": &Dependencies{All: []string{"b", "x"}, Link: []string{"b", "x"}},
+		"b": &Dependencies{All: []string{}},
+	}
+	_, err = graph.order([]string{"a"}, false)
+	if err == nil || strings.Contains(err.Error(), "Cyclic") {
+		t.Errorf("Error should not have mentioned cycles, got %v", err)
+	}
+	for _, expected := range []string{
+		"Missing dependency: b (not targeted and not running), referenced by a via link",
+		"Missing dependency: x (not declared), referenced by a via link",
+	} {
+		if !strings.Contains(err.Error(), expected) {
+			t.Errorf("Error should have contained `%s`, got %v", expected, err)
+		}
+	}
+}
+
+func TestOrderIsDeterministicAndPure(t *testing.T) {
+	graph := DependencyGraph{
+		"a": &Dependencies{All: []string{"c"}, Link: []string{"c"}},
+		"b": &Dependencies{All: []string{"c"}, Link: []string{"c"}},
+		"c": &Dependencies{All: []string{}},
+		"d": &Dependencies{All: []string{}},
+	}
+	expected := []string{"d", "b", "a", "c"}
+	for i := 0; i < 10; i++ {
+		order, err := graph.order([]string{"d", "b", "c", "a"}, false)
+		if err != nil || !reflect.DeepEqual(order, expected) {
+			t.Errorf("Order should have been %v, got %v. Err: %v", expected, order, err)
+		}
+	}
+	if len(graph) != 4 || len(graph["a"].All) != 1 || len(graph["b"].All) != 1 {
+		t.Errorf("Graph should have been left untouched, got %v", graph)
+	}
+}
+
+func TestJSON(t *testing.T) {
+	dependencyGraph := DependencyGraph{
+		"b": &Dependencies{Link: []string{"c"}, VolumesFrom: []string{"a"}},
+		"a": &Dependencies{Net: "b"},
+	}
+	var buffer bytes.Buffer
+	dependencyGraph.JSON(&buffer, Containers{&container{RawName: "a"}})
+	expected := `{
+  "containers": [
+    {
+      "name": "a",
+      "declared": true,
+      "targeted": true
+    },
+    {
+      "name": "b",
+      "declared": true,
+      "targeted": false
+    },
+    {
+      "name": "c",
+      "declared": false,
+      "targeted": false
+    }
+  ],
+  "edges": [
+    {
+      "from": "a",
+      "to": "b",
+      "kind": "net"
+    },
+    {
+      "from": "b",
+      "to": "c",
+      "kind": "link"
+    },
+    {
+      "from": "b",
+      "to": "a",
+      "kind": "volumesFrom"
+    }
+  ]
+}
+`
+	if expected != buffer.String() {
+		t.Errorf("Invalid JSON received. Expected `%v`, got `%v`", expected, buffer.String())
+	}
+}
+
+func TestMermaid(t *testing.T) {
+	dependencyGraph := DependencyGraph{
+		"b": &Dependencies{Link: []string{"c"}, VolumesFrom: []string{"a"}},
+		"a": &Dependencies{Net: "b"},
+	}
+	var buffer bytes.Buffer
+	dependencyGraph.Mermaid(&buffer, Containers{&container{RawName: "a"}})
+	expected := `graph TD
+  n0["a"]
+  class n0 declared
+  class n0 targeted
+  n1["b"]
+  class n1 declared
+  n2["c"]
+  n0 ==>|net| n1
+  n1 -->|link| n2
+  n1 -.->|volumesFrom| n0
+  classDef declared font-weight:bold
+  classDef targeted stroke:red
+`
+	if expected != buffer.String() {
+		t.Errorf("Invalid Mermaid received. Expected `%v`, got `%v`", expected, buffer.String())
+	}
+}
+
+func TestTree(t *testing.T) {
+	dependencyGraph := DependencyGraph{
+		"a": &Dependencies{Link: []string{"b", "c"}},
+		"b": &Dependencies{VolumesFrom: []string{"d"}},
+		"c": &Dependencies{Net: "a"},
+		"d": &Dependencies{},
+		"e": &Dependencies{},
+	}
+	var buffer bytes.Buffer
+	dependencyGraph.Tree(&buffer, Containers{&container{RawName: "b"}})
+	// a, b, c and d are only reachable through the a <-> c cycle
+	expected := `e
+a
+├── b * (link)
+│   └── d (volumesFrom)
+└── c (link)
+    └── a (net, cycle)
+`
+	if expected != buffer.String() {
+		t.Errorf("Invalid tree received. Expected `%v`, got `%v`", expected, buffer.String())
+	}
+	delete(dependencyGraph, "c")
+	buffer.Reset()
+	dependencyGraph.Tree(&buffer, Containers{&container{RawName: "b"}})
+	expected = `a
+├── b * (link)
+│   └── d (volumesFrom)
+└── c (link)
+e
+`
+	if expected != buffer.String() {
+		t.Errorf("Invalid tree received. Expected `%v`, got `%v`", expected, buffer.String())
+	}
+}
+
+func TestDOTWithOptions(t *testing.T) {
+	dependencyGraph := DependencyGraph{
+		"a": &Dependencies{Link: []string{"b"}},
+		"b": &Dependencies{},
+		"c": &Dependencies{},
+	}
+	options := DOTOptions{
+		States: map[string]*ContainerState{
+			"a": &ContainerState{State: "running", ImageOutdated: true},
+			"b": &ContainerState{State: "stopped"},
+			"c": &ContainerState{State: "missing"},
+		},
+		Groups: map[string][]string{"backend": []string{"a", "b"}, "db": []string{"b"}, "misc": []string{"b", "c"}},
+	}
+	var buffer bytes.Buffer
+	dependencyGraph.DOT(&buffer, Containers{&container{RawName: "a"}}, options)
+	expected := `digraph {
+  "a" [style="bold,filled",fillcolor=palegreen,label="a\n(outdated image)",color=red]
+  "a"->"b"
+  "b" [style="bold,filled",fillcolor=gold]
+  "c" [style="bold,filled",fillcolor=lightgrey]
+  subgraph "cluster_backend" {
+    label="backend"
+    "a"
+    "b"
+  }
+  subgraph "cluster_misc" {
+    label="misc"
+    "c"
+  }
+}`
+	if expected != buffer.String() {
+		t.Errorf("Invalid graph received. Expected `%v`, got `%v`", expected, buffer.String())
+	}
+}
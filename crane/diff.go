@@ -0,0 +1,192 @@
+package crane
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// FieldDiff holds the values of a field of a container
+// which differ between the config and the live container
+type FieldDiff struct {
+	Field      string   `json:"field"`
+	Configured []string `json:"configured"`
+	Actual     []string `json:"actual"`
+}
+
+// inspectedContainer is the part of the
+// `docker inspect` output being compared
+type inspectedContainer struct {
+	Config struct {
+		Image string
+		Env   []string
+		Cmd   []string
+	}
+	HostConfig struct {
+		Binds        []string
+		Links        []string
+		PortBindings map[string][]struct {
+			HostIp   string
+			HostPort string
+		}
+	}
+}
+
+// Diff compares the configured parameters of the container with the
+// ones of the live container. Returns nil if the container does not exist.
+func (c *container) Diff() []FieldDiff {
+	if !c.Exists() {
+		return nil
+	}
+	output, err := commandOutput("docker", []string{"inspect", "--format={{json .}}", c.Id()})
+	if err != nil {
+		panic(StatusError{fmt.Errorf("Could not inspect container %s: %s", c.Name(), output), 1})
+	}
+	var live inspectedContainer
+	if err := json.Unmarshal([]byte(output), &live); err != nil {
+		panic(StatusError{fmt.Errorf("Could not parse inspect output of container %s: %s", c.Name(), err), 65})
+	}
+	return c.diff(live)
+}
+
+// diff compares the configured parameters of the
+// container with the inspected ones, field by field
+func (c *container) diff(live inspectedContainer) []FieldDiff {
+	diffs := []FieldDiff{}
+	add := func(field string, configured []string, actual []string) {
+		if len(configured) > 0 || len(actual) > 0 {
+			diffs = append(diffs, FieldDiff{field, configured, actual})
+		}
+	}
+	if c.Image() != live.Config.Image {
+		add("image", []string{c.Image()}, []string{live.Config.Image})
+	}
+	// the env of the container includes the one of the image,
+	// so only the variables which are configured are compared
+	env := lastValues(c.RunParams.Env())
+	configuredEnv := make(map[string]bool)
+	for _, variable := range env {
+		configuredEnv[strings.SplitN(variable, "=", 2)[0]] = true
+	}
+	var liveEnv []string
+	for _, variable := range live.Config.Env {
+		if configuredEnv[strings.SplitN(variable, "=", 2)[0]] {
+			liveEnv = append(liveEnv, variable)
+		}
+	}
+	add("env", difference(env, liveEnv), difference(liveEnv, env))
+	var ports []string
+	for port, bindings := range live.HostConfig.PortBindings {
+		for _, binding := range bindings {
+			ports = append(ports, normalizePort(strings.Join([]string{binding.HostIp, binding.HostPort, port}, ":")))
+		}
+	}
+	var publish []string
+	for _, port := range c.RunParams.Publish() {
+		publish = append(publish, normalizePort(port))
+	}
+	add("ports", difference(publish, ports), difference(ports, publish))
+	// anonymous volumes are not listed in the binds
+	var volumes []string
+	for _, volume := range c.Volumes() {
+		if strings.Contains(volume, ":") {
+			volumes = append(volumes, volume)
+		}
+	}
+	add("volumes", difference(volumes, live.HostConfig.Binds), difference(live.HostConfig.Binds, volumes))
+	var links []string
+	for _, link := range live.HostConfig.Links {
+		// links are given as /<container>:/<name>/<alias>
+		parts := strings.Split(link, ":")
+		links = append(links, strings.TrimPrefix(parts[0], "/")+":"+parts[len(parts)-1][strings.LastIndex(parts[len(parts)-1], "/")+1:])
+	}
+	var configuredLinks []string
+	if len(c.sharedNetwork) == 0 {
+		for _, link := range c.RunParams.Link() {
+			parts := strings.Split(link, ":")
+			configuredLinks = append(configuredLinks, parts[0]+":"+parts[len(parts)-1])
+		}
+	}
+	add("links", difference(configuredLinks, links), difference(links, configuredLinks))
+	// without a configured command, the one of the image is used
+	if cmd := c.RunParams.Cmd(); len(cmd) > 0 && strings.Join(cmd, " ") != strings.Join(live.Config.Cmd, " ") {
+		add("cmd", []string{strings.Join(cmd, " ")}, []string{strings.Join(live.Config.Cmd, " ")})
+	}
+	return diffs
+}
+
+// normalizePort turns a published port into the
+// form [ip:]host:container/protocol
+func normalizePort(port string) string {
+	parts := strings.Split(port, ":")
+	containerPort := parts[len(parts)-1]
+	if !strings.Contains(containerPort, "/") {
+		containerPort += "/tcp"
+	}
+	hostPort, ip := "", ""
+	if len(parts) > 1 {
+		hostPort = parts[len(parts)-2]
+	}
+	if len(parts) > 2 && len(parts[0]) > 0 && parts[0] != "0.0.0.0" {
+		ip = parts[0] + ":"
+	}
+	return ip + hostPort + ":" + containerPort
+}
+
+// lastValues returns the environment variables
+// without the ones overridden by later values
+// of the same variable, as docker does
+func lastValues(env []string) []string {
+	var result []string
+	for i, variable := range env {
+		name := strings.SplitN(variable, "=", 2)[0]
+		overridden := false
+		for _, later := range env[i+1:] {
+			if strings.SplitN(later, "=", 2)[0] == name {
+				overridden = true
+				break
+			}
+		}
+		if !overridden {
+			result = append(result, variable)
+		}
+	}
+	return result
+}
+
+// difference returns the sorted values of a which are not in b
+func difference(a []string, b []string) []string {
+	var result []string
+	for _, value := range a {
+		if !Target(b).includes(value) {
+			result = append(result, value)
+		}
+	}
+	sort.Strings(result)
+	return result
+}
+
+// displayDiff displays the differences of a container, the
+// configured values prefixed with - and the actual ones with +
+func displayDiff(writer io.Writer, name string, exists bool, diffs []FieldDiff) {
+	if !exists {
+		fmt.Fprintf(writer, "%s: does not exist\n", name)
+		return
+	}
+	if len(diffs) == 0 {
+		fmt.Fprintf(writer, "%s: no differences\n", name)
+		return
+	}
+	fmt.Fprintf(writer, "%s:\n", name)
+	for _, diff := range diffs {
+		fmt.Fprintf(writer, "  %s:\n", diff.Field)
+		for _, value := range diff.Configured {
+			fmt.Fprintf(writer, "    - %s\n", value)
+		}
+		for _, value := range diff.Actual {
+			fmt.Fprintf(writer, "    + %s\n", value)
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package crane
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+	os.Clearenv()
+	c := &container{
+		RawImage: "nginx:1.9",
+		RunParams: RunParameters{
+			RawEnv:     []string{"A=0", "B=2", "A=1"},
+			RawPublish: []string{"8080:80", "127.0.0.1:443:443", "53/udp"},
+			RawVolume:  []string{"/data:/data", "/cache"},
+			RawLink:    []string{"db:database", "cache"},
+			RawCmd:     []interface{}{"nginx", "-g", "daemon off;"},
+		},
+	}
+	var live inspectedContainer
+	err := json.Unmarshal([]byte(`{
+		"Config": {"Image": "nginx:1.8", "Env": ["PATH=/bin", "A=1", "B=3"], "Cmd": ["nginx"]},
+		"HostConfig": {
+			"Binds": ["/data:/data", "/logs:/var/log"],
+			"Links": ["/db:/web/database"],
+			"PortBindings": {
+				"80/tcp": [{"HostIp": "", "HostPort": "8080"}],
+				"443/tcp": [{"HostIp": "127.0.0.1", "HostPort": "443"}],
+				"53/udp": [{"HostIp": "", "HostPort": ""}]
+			}
+		}
+	}`), &live)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []FieldDiff{
+		{"image", []string{"nginx:1.9"}, []string{"nginx:1.8"}},
+		{"env", []string{"B=2"}, []string{"B=3"}},
+		{"volumes", nil, []string{"/logs:/var/log"}},
+		{"links", []string{"cache:cache"}, nil},
+		{"cmd", []string{"nginx -g daemon off;"}, []string{"nginx"}},
+	}
+	if diffs := c.diff(live); !reflect.DeepEqual(diffs, expected) {
+		t.Errorf("Differences should have been %v, got %v", expected, diffs)
+	}
+}
+
+func TestDisplayDiff(t *testing.T) {
+	var out bytes.Buffer
+	displayDiff(&out, "web", true, []FieldDiff{{"env", []string{"A=1"}, []string{"A=2"}}})
+	displayDiff(&out, "db", true, []FieldDiff{})
+	displayDiff(&out, "cache", false, nil)
+	expected := "web:\n  env:\n    - A=1\n    + A=2\ndb: no differences\ncache: does not exist\n"
+	if out.String() != expected {
+		t.Errorf("Output should have been %q, got %q", expected, out.String())
+	}
+}
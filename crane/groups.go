@@ -0,0 +1,163 @@
+package crane
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// groupSettings holds the defaults of a group,
+// applying to all of its containers
+type groupSettings struct {
+	Env                 []string
+	CascadeDependencies string
+	CascadeAffected     string
+}
+
+// parseGroup parses the raw definition of a group, which is either a
+// list of references (containers or other groups), or an object with
+// such a list under `containers` along with the group settings.
+func parseGroup(name string, rawGroup interface{}) (references []string, settings groupSettings) {
+	var rawReferences interface{}
+	switch group := rawGroup.(type) {
+	case []interface{}:
+		rawReferences = group
+	case map[interface{}]interface{}:
+		rawSettings := make(map[string]interface{})
+		for key, value := range group {
+			rawSettings[fmt.Sprint(key)] = value
+		}
+		rawReferences, settings = parseGroupSettings(name, rawSettings)
+	case map[string]interface{}:
+		rawReferences, settings = parseGroupSettings(name, group)
+	case nil:
+	default:
+		panic(StatusError{fmt.Errorf("Group %s is of unknown type", name), 65})
+	}
+	references = stringList(name, rawReferences)
+	return
+}
+
+// parseGroupSettings parses the object form of a group
+func parseGroupSettings(name string, rawSettings map[string]interface{}) (rawReferences interface{}, settings groupSettings) {
+	for key, value := range rawSettings {
+		switch key {
+		case "containers":
+			rawReferences = value
+		case "env":
+			settings.Env = stringList(name, value)
+		case "cascade-dependencies":
+			settings.CascadeDependencies = os.ExpandEnv(fmt.Sprint(value))
+		case "cascade-affected":
+			settings.CascadeAffected = os.ExpandEnv(fmt.Sprint(value))
+		default:
+			panic(StatusError{fmt.Errorf("Unknown setting `%s` for group %s", key, name), 65})
+		}
+	}
+	for _, value := range []string{settings.CascadeDependencies, settings.CascadeAffected} {
+		if len(value) > 0 && !validCascadingValue(value) {
+			panic(StatusError{fmt.Errorf("Invalid cascading value `%s` for group %s", value, name), 78})
+		}
+	}
+	return
+}
+
+// stringList converts a raw list into a list
+// of strings with expanded variables
+func stringList(name string, rawList interface{}) (list []string) {
+	if rawList == nil {
+		return
+	}
+	rawItems, ok := rawList.([]interface{})
+	if !ok {
+		panic(StatusError{fmt.Errorf("Group %s should contain lists only", name), 65})
+	}
+	for _, rawItem := range rawItems {
+		list = append(list, os.ExpandEnv(fmt.Sprint(rawItem)))
+	}
+	return
+}
+
+// nestedGroups returns the given group followed by the groups
+// it references, directly or not, depth first. Returns nothing
+// if name is not a group.
+func nestedGroups(references map[string][]string, name string) []string {
+	if _, isGroup := references[name]; !isGroup {
+		return nil
+	}
+	groups := []string{name}
+	for _, reference := range references[name] {
+		for _, group := range nestedGroups(references, reference) {
+			if !Target(groups).includes(group) {
+				groups = append(groups, group)
+			}
+		}
+	}
+	return groups
+}
+
+// groupDepths maps each group to its depth: 0 for the groups
+// no other group references, and one more than the deepest
+// group referencing it for the others
+func groupDepths(references map[string][]string) map[string]int {
+	depths := make(map[string]int)
+	var deepen func(name string, depth int)
+	deepen = func(name string, depth int) {
+		if current, ok := depths[name]; ok && current >= depth {
+			return
+		}
+		depths[name] = depth
+		for _, reference := range references[name] {
+			if _, isGroup := references[reference]; isGroup {
+				deepen(reference, depth+1)
+			}
+		}
+	}
+	for name := range references {
+		deepen(name, 0)
+	}
+	return depths
+}
+
+// flattenGroups resolves the references to other groups, so that each
+// group maps to the containers it contains, directly or not. Panics if
+// groups reference each other in a cycle.
+func flattenGroups(references map[string][]string) map[string][]string {
+	groups := make(map[string][]string)
+	var flatten func(name string, path []string) []string
+	flatten = func(name string, path []string) []string {
+		for _, onPath := range path {
+			if onPath == name {
+				cycle := strings.Join(append(path, name), " -> ")
+				panic(StatusError{fmt.Errorf("Cyclic group references found: %s", cycle), 78})
+			}
+		}
+		if containers, ok := groups[name]; ok {
+			return containers
+		}
+		containers := []string{}
+		for _, reference := range references[name] {
+			if _, isGroup := references[reference]; isGroup {
+				for _, container := range flatten(reference, append(path, name)) {
+					if !Target(containers).includes(container) {
+						containers = append(containers, container)
+					}
+				}
+			} else if !Target(containers).includes(reference) {
+				containers = append(containers, reference)
+			}
+		}
+		groups[name] = containers
+		return containers
+	}
+	names := []string{}
+	for name := range references {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		flatten(name, []string{})
+	}
+	return groups
+}
@@ -0,0 +1,68 @@
+package crane
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseGroup(t *testing.T) {
+	// List
+	references, settings := parseGroup("a", []interface{}{"x", "y"})
+	if !reflect.DeepEqual(references, []string{"x", "y"}) || !reflect.DeepEqual(settings, groupSettings{}) {
+		t.Errorf("Group should have contained x and y without settings, got %v and %v", references, settings)
+	}
+	// Object (YAML)
+	references, settings = parseGroup("a", map[interface{}]interface{}{
+		"containers":           []interface{}{"x"},
+		"env":                  []interface{}{"A=1"},
+		"cascade-dependencies": "link",
+	})
+	expected := groupSettings{Env: []string{"A=1"}, CascadeDependencies: "link"}
+	if !reflect.DeepEqual(references, []string{"x"}) || !reflect.DeepEqual(settings, expected) {
+		t.Errorf("Group should have contained x with settings %v, got %v and %v", expected, references, settings)
+	}
+	// Object (JSON)
+	references, settings = parseGroup("a", map[string]interface{}{
+		"containers":       []interface{}{"x"},
+		"cascade-affected": "all",
+	})
+	expected = groupSettings{CascadeAffected: "all"}
+	if !reflect.DeepEqual(references, []string{"x"}) || !reflect.DeepEqual(settings, expected) {
+		t.Errorf("Group should have contained x with settings %v, got %v and %v", expected, references, settings)
+	}
+	// Invalid cascading value
+	defer func() {
+		if recover() == nil {
+			t.Errorf("Invalid cascading value should have caused a panic")
+		}
+	}()
+	parseGroup("a", map[string]interface{}{"cascade-affected": "everything"})
+}
+
+func TestFlattenGroups(t *testing.T) {
+	groups := flattenGroups(map[string][]string{
+		"all":      []string{"frontend", "backend", "infra"},
+		"frontend": []string{"web"},
+		"backend":  []string{"api", "worker", "infra"},
+		"infra":    []string{"db"},
+	})
+	expected := map[string][]string{
+		"all":      []string{"web", "api", "worker", "db"},
+		"frontend": []string{"web"},
+		"backend":  []string{"api", "worker", "db"},
+		"infra":    []string{"db"},
+	}
+	if !reflect.DeepEqual(groups, expected) {
+		t.Errorf("Groups should have been %v, got %v", expected, groups)
+	}
+	// Cycle
+	defer func() {
+		if recover() == nil {
+			t.Errorf("Cyclic group references should have caused a panic")
+		}
+	}()
+	flattenGroups(map[string][]string{
+		"a": []string{"b"},
+		"b": []string{"a"},
+	})
+}
@@ -0,0 +1,74 @@
+package crane
+
+import (
+	"fmt"
+	"os"
+)
+
+// Hooks holds the commands to run at given
+// points of the lifecycle of a container
+type Hooks struct {
+	BeforeRun  []Hook `json:"before-run" yaml:"before-run"`
+	AfterRun   []Hook `json:"after-run" yaml:"after-run"`
+	AfterStart []Hook `json:"after-start" yaml:"after-start"`
+	BeforeStop []Hook `json:"before-stop" yaml:"before-stop"`
+	AfterBuild []Hook `json:"after-build" yaml:"after-build"`
+}
+
+// Hook is a command run either on the host, or
+// inside the running container via `docker exec`
+type Hook struct {
+	RawHost string `json:"host" yaml:"host"`
+	RawExec string `json:"exec" yaml:"exec"`
+}
+
+func (h Hook) Host() string {
+	return os.ExpandEnv(h.RawHost)
+}
+
+func (h Hook) Exec() string {
+	return os.ExpandEnv(h.RawExec)
+}
+
+// validate checks that each hook has either a host or an exec
+// command, and that exec commands are only given for events
+// where the container is running. After run and start, crane
+// only gets to run the hooks once a detached container runs.
+func (h *Hooks) validate(name string, detach bool) {
+	events := []struct {
+		name   string
+		hooks  []Hook
+		execOk bool
+	}{
+		{"before-run", h.BeforeRun, false},
+		{"after-run", h.AfterRun, detach},
+		{"after-start", h.AfterStart, detach},
+		{"before-stop", h.BeforeStop, true},
+		{"after-build", h.AfterBuild, false},
+	}
+	for _, event := range events {
+		for _, hook := range event.hooks {
+			if (len(hook.RawHost) > 0) == (len(hook.RawExec) > 0) {
+				panic(StatusError{fmt.Errorf("Each %s hook of container %s needs either `host` or `exec`", event.name, name), 78})
+			}
+			if len(hook.RawExec) > 0 && !event.execOk {
+				panic(StatusError{fmt.Errorf("The %s hooks of container %s cannot use `exec` as it is not running detached", event.name, name), 78})
+			}
+		}
+	}
+}
+
+// runHooks runs the given hooks of container in order, the host
+// commands from the directory of the config file. A failing hook
+// aborts with its exit status.
+func (c *container) runHooks(event string, hooks []Hook) {
+	for _, hook := range hooks {
+		if len(hook.Host()) > 0 {
+			fmt.Printf("Running %s hook of container %s ... ", event, c.Name())
+			executeCommandIn(c.hookDir, "sh", []string{"-c", hook.Host()})
+		} else {
+			fmt.Printf("Running %s hook in container %s ... ", event, c.Name())
+			executeCommand("docker", []string{"exec", c.Name(), "sh", "-c", hook.Exec()})
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package crane
+
+import (
+	"testing"
+)
+
+func TestUnmarshalHooks(t *testing.T) {
+	yaml := []byte(
+		`containers:
+  mysql:
+    image: mysql
+    hooks:
+      after-start:
+        - exec: "mysqladmin --wait=30 ping"
+        - host: "./migrate.sh"
+      after-run:
+        - host: "./seed.sh"
+`)
+	hooks := unmarshalYAML(yaml).RawContainerMap["mysql"].Hooks
+	if len(hooks.AfterStart) != 2 || hooks.AfterStart[0].Exec() != "mysqladmin --wait=30 ping" || hooks.AfterStart[1].Host() != "./migrate.sh" {
+		t.Errorf("Container should have had 2 after-start hooks, got %v", hooks.AfterStart)
+	}
+	if len(hooks.AfterRun) != 1 || hooks.AfterRun[0].Host() != "./seed.sh" {
+		t.Errorf("Container should have had 1 after-run hook, got %v", hooks.AfterRun)
+	}
+}
+
+func TestValidateHooks(t *testing.T) {
+	var hooks *Hooks
+	mustPanic := func(description string) {
+		defer func() {
+			if recover() == nil {
+				t.Errorf("%s should have caused a panic", description)
+			}
+		}()
+		hooks.validate("a", true)
+	}
+	hooks = &Hooks{AfterStart: []Hook{Hook{RawExec: "true"}}, BeforeRun: []Hook{Hook{RawHost: "true"}}}
+	hooks.validate("a", true)
+	hooks = &Hooks{AfterRun: []Hook{Hook{}}}
+	mustPanic("Hook without command")
+	hooks = &Hooks{AfterRun: []Hook{Hook{RawHost: "true", RawExec: "true"}}}
+	mustPanic("Hook with both commands")
+	hooks = &Hooks{BeforeRun: []Hook{Hook{RawExec: "true"}}}
+	mustPanic("Exec hook before run")
+	hooks = &Hooks{AfterBuild: []Hook{Hook{RawExec: "true"}}}
+	mustPanic("Exec hook after build")
+	hooks = &Hooks{AfterStart: []Hook{Hook{RawExec: "true"}}}
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Errorf("Exec hook after start of a container which is not detached should have caused a panic")
+			}
+		}()
+		hooks.validate("a", false)
+	}()
+	hooks = &Hooks{BeforeStop: []Hook{Hook{RawExec: "true"}}}
+	hooks.validate("a", false)
+}
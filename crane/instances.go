@@ -0,0 +1,122 @@
+package crane
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// instanceName returns the name of the
+// given instance of a scaled container
+func instanceName(name string, instance int) string {
+	return name + "-" + strconv.Itoa(instance)
+}
+
+// setInstances replaces each container having instances by one container
+// per instance, named <name>-<i>, and declares a group <name> containing
+// all of them. Links to such containers are expanded to link all of their
+// instances, while using their volumes or sharing their network stack
+// requires to refer to one instance. The given overrides take precedence
+// over the configured number of instances, and may be 0.
+func (c *config) setInstances(overrides map[string]int) {
+	overridden := make(map[string]bool)
+	for name, instances := range overrides {
+		found := false
+		for rawName, container := range c.RawContainerMap {
+			if os.ExpandEnv(rawName) == name {
+				container.Instances = instances
+				overridden[rawName] = true
+				found = true
+			}
+		}
+		if !found {
+			panic(StatusError{fmt.Errorf("No container named `%s` to scale", name), 64})
+		}
+	}
+	c.instances = make(map[string]int)
+	scaled := make(map[string]*container)
+	for rawName, container := range c.RawContainerMap {
+		if container.Instances != 0 || overridden[rawName] {
+			scaled[rawName] = container
+		}
+	}
+	for rawName, container := range scaled {
+		name := os.ExpandEnv(rawName)
+		if container.Instances < 0 {
+			panic(StatusError{fmt.Errorf("Invalid number of instances %d for container %s", container.Instances, name), 78})
+		}
+		if _, ok := c.RawGroups[name]; ok {
+			panic(StatusError{fmt.Errorf("Container %s has instances and cannot share its name with a group", name), 78})
+		}
+		if c.RawGroups == nil {
+			c.RawGroups = make(map[string]interface{})
+		}
+		group := []interface{}{}
+		delete(c.RawContainerMap, rawName)
+		for i := 1; i <= container.Instances; i++ {
+			instance := *container
+			instance.Instances = 0
+			instance.RunParams.RawEnv = append(append([]string{}, container.RunParams.RawEnv...), "CRANE_INSTANCE="+strconv.Itoa(i))
+			c.RawContainerMap[instanceName(rawName, i)] = &instance
+			group = append(group, instanceName(name, i))
+		}
+		c.RawGroups[name] = group
+		c.instances[name] = container.Instances
+	}
+	if len(c.instances) == 0 {
+		return
+	}
+	for rawName, container := range c.RawContainerMap {
+		name := os.ExpandEnv(rawName)
+		for _, volumesFrom := range container.RunParams.VolumesFrom() {
+			source := strings.Split(volumesFrom, ":")[0]
+			if _, scaled := c.instances[source]; scaled {
+				panic(StatusError{fmt.Errorf("Container %s cannot use the volumes of %s, which has instances. Refer to one of them instead, e.g. %s", name, source, instanceName(source, 1)), 78})
+			}
+		}
+		if net := container.RunParams.Net(); strings.HasPrefix(net, "container:") {
+			source := strings.TrimPrefix(net, "container:")
+			if _, scaled := c.instances[source]; scaled {
+				panic(StatusError{fmt.Errorf("Container %s cannot share the network stack of %s, which has instances. Refer to one of them instead, e.g. container:%s", name, source, instanceName(source, 1)), 78})
+			}
+		}
+		var links []string
+		for _, rawLink := range container.RunParams.RawLink {
+			linkParts := strings.Split(os.ExpandEnv(rawLink), ":")
+			instances, scaled := c.instances[linkParts[0]]
+			if !scaled {
+				links = append(links, rawLink)
+				continue
+			}
+			alias := linkParts[len(linkParts)-1]
+			for i := 1; i <= instances; i++ {
+				links = append(links, instanceName(linkParts[0], i)+":"+instanceName(alias, i))
+			}
+		}
+		container.RunParams.RawLink = links
+	}
+}
+
+// Surplus returns the existing instances of the targeted scaled
+// containers which exceed their number of instances, as well as
+// all instances of the containers scaled to 0
+func (c *config) Surplus() Containers {
+	var surplus Containers
+	// spare the lookup of the orphans if nothing is scaled
+	if len(c.instances) == 0 {
+		return surplus
+	}
+	for _, orphan := range c.Orphans() {
+		i := strings.LastIndex(orphan.Name(), "-")
+		if i < 0 {
+			continue
+		}
+		name := orphan.Name()[:i]
+		instance, err := strconv.Atoi(orphan.Name()[i+1:])
+		if instances, scaled := c.instances[name]; scaled && err == nil && instance > instances && (instances == 0 || c.target.includes(instanceName(name, 1))) {
+			surplus = append(surplus, orphan)
+		}
+	}
+	return surplus
+}
@@ -0,0 +1,77 @@
+package crane
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSetInstances(t *testing.T) {
+	c := &config{RawContainerMap: containerMap{
+		"web":   &container{Instances: 2, RunParams: RunParameters{RawEnv: []string{"A=1"}}},
+		"proxy": &container{RunParams: RunParameters{RawLink: []string{"web:backend", "db:db"}}},
+		"db":    &container{},
+	}}
+	c.setInstances(nil)
+	c.expandEnv()
+	if _, ok := c.containerMap["web"]; ok || len(c.containerMap) != 4 {
+		t.Errorf("Container web should have been replaced by its instances, got %v", c.containerMap)
+	}
+	if env := c.RawContainerMap["web-2"].RunParams.Env(); !reflect.DeepEqual(env, []string{"A=1", "CRANE_INSTANCE=2"}) {
+		t.Errorf("Instance web-2 should have had its instance number in its env, got %v", env)
+	}
+	if group := c.groups["web"]; !reflect.DeepEqual(group, []string{"web-1", "web-2"}) {
+		t.Errorf("Group web should have contained the instances, got %v", group)
+	}
+	expected := []string{"web-1:backend-1", "web-2:backend-2", "db:db"}
+	if links := c.RawContainerMap["proxy"].RunParams.Link(); !reflect.DeepEqual(links, expected) {
+		t.Errorf("Links should have been %v, got %v", expected, links)
+	}
+	// Override
+	c = &config{RawContainerMap: containerMap{"web": &container{Instances: 2}}}
+	c.setInstances(map[string]int{"web": 3})
+	if len(c.RawContainerMap) != 3 || c.instances["web"] != 3 {
+		t.Errorf("Container web should have had 3 instances, got %v", c.RawContainerMap)
+	}
+	// Scaled to 0
+	c = &config{RawContainerMap: containerMap{"web": &container{Instances: 2}}}
+	c.setInstances(map[string]int{"web": 0})
+	if _, scaled := c.instances["web"]; !scaled || len(c.RawContainerMap) != 0 {
+		t.Errorf("Container web should have had no instances, got %v", c.RawContainerMap)
+	}
+	// Volumes and network stack of a scaled container
+	for _, dependent := range []*container{
+		{RunParams: RunParameters{RawVolumesFrom: []string{"web:ro"}}},
+		{RunParams: RunParameters{RawNet: "container:web"}},
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("Referring to the scaled container web from %v should have caused a panic", dependent.RunParams)
+				}
+			}()
+			c = &config{RawContainerMap: containerMap{"web": &container{Instances: 2}, "backup": dependent}}
+			c.setInstances(nil)
+		}()
+	}
+	c = &config{RawContainerMap: containerMap{"web": &container{Instances: 2}, "backup": &container{RunParams: RunParameters{RawVolumesFrom: []string{"web-1"}}}}}
+	c.setInstances(nil)
+	// Unknown container
+	defer func() {
+		if recover() == nil {
+			t.Errorf("Scaling an unknown container should have caused a panic")
+		}
+	}()
+	c.setInstances(map[string]int{"db": 2})
+}
+
+func TestParseScale(t *testing.T) {
+	scale, err := parseScale([]string{"web=3", "worker=0"})
+	if err != nil || !reflect.DeepEqual(scale, map[string]int{"web": 3, "worker": 0}) {
+		t.Errorf("Scale should have been web=3 and worker=0, got %v (%v)", scale, err)
+	}
+	for _, args := range [][]string{{}, {"web"}, {"web=x"}, {"web=-1"}} {
+		if _, err := parseScale(args); err == nil {
+			t.Errorf("Arguments %v should have been invalid", args)
+		}
+	}
+}
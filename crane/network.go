@@ -0,0 +1,24 @@
+package crane
+
+// NetworkMap maps the network name
+// to its configuration
+type NetworkMap map[string]*network
+
+type network struct {
+	resource `yaml:",inline"`
+}
+
+func (n *network) Exists() bool {
+	return n.exists("network")
+}
+
+// Create the network unless it already exists
+func (n *network) Create() {
+	n.create("network", []string{n.Name()})
+}
+
+// Remove the network if it was created by crane for this config,
+// unless it still has members (running or not)
+func (n *network) Rm() {
+	n.rm("network")
+}
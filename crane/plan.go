@@ -0,0 +1,229 @@
+package crane
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// Kinds of actions of a plan
+const (
+	ActionBuild    = "build"
+	ActionPull     = "pull"
+	ActionCreate   = "create"
+	ActionStart    = "start"
+	ActionRecreate = "recreate"
+	ActionRemove   = "remove"
+	ActionUnknown  = "unknown"
+)
+
+// Action is a step of a plan, applied to one container. The ids of the
+// container and of its image (empty if they did not exist) are recorded
+// when planning, so that a saved plan is only executed as long as they
+// did not change. Recreations list the fields of the definition which
+// changed since the container was run.
+type Action struct {
+	Kind        string      `json:"kind"`
+	Container   string      `json:"container"`
+	Reason      string      `json:"reason"`
+	ContainerId string      `json:"container-id"`
+	ImageId     string      `json:"image-id"`
+	Changes     []FieldDiff `json:"changes,omitempty"`
+	container   Container
+}
+
+// Plan lists the actions bringing the containers in line with the
+// config. The definitions of all planned containers are recorded as
+// well, including the ones without actions, so that a saved plan is
+// refused once the config of any of them changed.
+type Plan struct {
+	Config      string            `json:"config"`
+	Definitions map[string]string `json:"definitions"`
+	Actions     []Action          `json:"actions"`
+}
+
+// symbols displayed for the kinds of actions
+var actionSymbols = map[string]string{
+	ActionBuild:    "*",
+	ActionPull:     "*",
+	ActionCreate:   "+",
+	ActionStart:    ">",
+	ActionRecreate: "~",
+	ActionRemove:   "-",
+	ActionUnknown:  "?",
+}
+
+// newPlan determines the actions needed for the given containers (in
+// dependency order): provisioning missing images (or the ones to pull
+// always), creating missing containers, recreating the ones whose
+// definition changed and starting stopped ones. The existing containers
+// linking to a recreated container are recreated right after it, even if
+// they are not targeted. Before that, the orphans get removed. Containers
+// whose definition is not known are reported, but not recreated.
+func newPlan(config Config, containers Containers, orphans Containers) Plan {
+	plan := Plan{Config: config.Path(), Definitions: make(map[string]string), Actions: []Action{}}
+	recreated := make(map[string]bool)
+	add := func(kind string, container Container, reason string) *Action {
+		action := Action{kind, container.Name(), reason, container.Id(), "", nil, container}
+		if kind != ActionRemove {
+			action.ImageId = container.ImageId()
+		}
+		plan.Actions = append(plan.Actions, action)
+		return &plan.Actions[len(plan.Actions)-1]
+	}
+	for _, orphan := range orphans {
+		add(ActionRemove, orphan, "no longer declared")
+	}
+	for _, container := range containers {
+		plan.Definitions[container.Name()] = container.Definition()
+		if recreated[container.Name()] {
+			continue
+		}
+		if len(container.Dockerfile()) > 0 {
+			if !container.ImageExists() {
+				add(ActionBuild, container, "image does not exist")
+			}
+		} else if container.PullPolicy() == PullAlways {
+			add(ActionPull, container, "pull policy is "+PullAlways)
+		} else if container.PullPolicy() != PullNever && !container.ImageExists() {
+			add(ActionPull, container, "image does not exist")
+		}
+		if !container.Exists() {
+			add(ActionCreate, container, "does not exist")
+			continue
+		}
+		changes, known := container.DefinitionChanges()
+		if !known {
+			add(ActionUnknown, container, "definition unknown, recreate it to record it")
+		}
+		if len(changes) > 0 {
+			add(ActionRecreate, container, "definition changed").Changes = changes
+			for _, dependent := range linkDependents(config, container.Name()) {
+				if recreated[dependent.Name()] {
+					continue
+				}
+				recreated[dependent.Name()] = true
+				plan.Definitions[dependent.Name()] = dependent.Definition()
+				add(ActionRecreate, dependent, "links to "+container.Name()).Changes, _ = dependent.DefinitionChanges()
+			}
+		} else if !container.Running() {
+			add(ActionStart, container, "is not running")
+		}
+	}
+	return plan
+}
+
+// readPlan reads a plan saved as JSON
+func readPlan(filename string) Plan {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		panic(StatusError{err, 74})
+	}
+	var plan Plan
+	if err := json.Unmarshal(data, &plan); err != nil {
+		panic(StatusError{fmt.Errorf("Could not parse plan %s: %s", filename, err), 65})
+	}
+	return plan
+}
+
+// save the plan as JSON
+func (p Plan) save(filename string) {
+	data, _ := json.MarshalIndent(p, "", "  ")
+	if err := ioutil.WriteFile(filename, append(data, '\n'), 0644); err != nil {
+		panic(StatusError{err, 74})
+	}
+}
+
+// resolve looks up the containers of the actions of a saved plan in the
+// config, and returns an error if they or their images, or the definition
+// of any planned container, changed since the plan was made
+func (p *Plan) resolve(config Config) error {
+	if p.Config != config.Path() {
+		return fmt.Errorf("The plan was made for the config %s, not %s", p.Config, config.Path())
+	}
+	orphans := make(map[string]Container)
+	for _, orphan := range config.Orphans() {
+		orphans[orphan.Name()] = orphan
+	}
+	changes := []string{}
+	names := []string{}
+	for name := range p.Definitions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if container, ok := config.ContainerMap()[name]; !ok {
+			changes = append(changes, fmt.Sprintf("container %s is not declared anymore", name))
+		} else if container.Definition() != p.Definitions[name] {
+			changes = append(changes, fmt.Sprintf("definition of container %s was changed", name))
+		}
+	}
+	for i := range p.Actions {
+		action := &p.Actions[i]
+		container, ok := config.ContainerMap()[action.Container]
+		if action.Kind == ActionRemove {
+			container, ok = orphans[action.Container]
+		}
+		if !ok {
+			changes = append(changes, fmt.Sprintf("container %s cannot be found anymore", action.Container))
+			continue
+		}
+		action.container = container
+		if container.Id() != action.ContainerId {
+			changes = append(changes, fmt.Sprintf("container %s was changed", action.Container))
+		}
+		if action.Kind != ActionRemove && container.ImageId() != action.ImageId {
+			changes = append(changes, fmt.Sprintf("image of container %s was changed", action.Container))
+		}
+	}
+	if len(changes) > 0 {
+		return fmt.Errorf("The environment changed since the plan was made:\n  %s", strings.Join(changes, "\n  "))
+	}
+	return nil
+}
+
+// display the actions of the plan
+func (p Plan) display(writer io.Writer) {
+	if len(p.Actions) == 0 {
+		fmt.Fprintln(writer, "Nothing to do, the containers are up to date.")
+		return
+	}
+	w := new(tabwriter.Writer)
+	w.Init(writer, 0, 8, 1, '\t', 0)
+	for _, action := range p.Actions {
+		fmt.Fprintf(w, "%s %s\t%s\t%s\n", actionSymbols[action.Kind], action.Container, action.Kind, action.Reason)
+		for _, change := range action.Changes {
+			fmt.Fprintf(w, "    %s:\n", change.Field)
+			for _, value := range change.Configured {
+				fmt.Fprintf(w, "      - %s\n", value)
+			}
+			for _, value := range change.Actual {
+				fmt.Fprintf(w, "      + %s\n", value)
+			}
+		}
+	}
+	w.Flush()
+}
+
+// execute the actions of the plan in order
+func (p Plan) execute(timeout int) {
+	for _, action := range p.Actions {
+		switch action.Kind {
+		case ActionBuild, ActionPull:
+			action.container.Provision(false)
+		case ActionCreate:
+			action.container.Run()
+		case ActionStart:
+			action.container.Start()
+		case ActionRecreate:
+			Containers{action.container}.rm(true, timeout)
+			action.container.Run()
+		case ActionRemove:
+			Containers{action.container}.rm(true, timeout)
+		}
+	}
+}
@@ -0,0 +1,208 @@
+package crane
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Container stub with a given state
+type PlannedContainer struct {
+	Container
+	id          string
+	imageId     string
+	running     bool
+	imageExists bool
+	outdated    bool
+	unknown     bool
+}
+
+func (c *PlannedContainer) Id() string {
+	return c.id
+}
+
+func (c *PlannedContainer) Exists() bool {
+	return c.id != ""
+}
+
+func (c *PlannedContainer) Running() bool {
+	return c.running
+}
+
+func (c *PlannedContainer) ImageId() string {
+	return c.imageId
+}
+
+func (c *PlannedContainer) ImageExists() bool {
+	return c.imageExists
+}
+
+func (c *PlannedContainer) DefinitionChanges() ([]FieldDiff, bool) {
+	if c.outdated {
+		return []FieldDiff{{"image", []string{c.Image()}, []string{c.Image() + ":old"}}}, !c.unknown
+	}
+	return nil, !c.unknown
+}
+
+// Config stub for resolving plans
+type PlannedConfig struct {
+	Config
+	containerMap ContainerMap
+	orphans      Containers
+}
+
+func (c *PlannedConfig) Path() string {
+	return "/project/crane.yml"
+}
+
+func (c *PlannedConfig) ContainerMap() ContainerMap {
+	return c.containerMap
+}
+
+func (c *PlannedConfig) Orphans() Containers {
+	return c.orphans
+}
+
+func (c *PlannedConfig) DependencyGraph() DependencyGraph {
+	dependencyGraph := make(DependencyGraph)
+	for name, container := range c.containerMap {
+		dependencyGraph[name] = container.Dependencies()
+	}
+	return dependencyGraph
+}
+
+func plannedConfig(containers Containers, orphans Containers) *PlannedConfig {
+	containerMap := make(ContainerMap)
+	for _, container := range containers {
+		containerMap[container.Name()] = container
+	}
+	return &PlannedConfig{containerMap: containerMap, orphans: orphans}
+}
+
+func plannedContainers() (Containers, Containers) {
+	containers := Containers{
+		&PlannedContainer{&container{RawName: "db", RawImage: "mysql", RawPull: "missing"}, "1", "i1", true, true, false, false},
+		&PlannedContainer{&container{RawName: "app", RawImage: "app", RawDockerfile: "app"}, "2", "", false, false, true, false},
+		&PlannedContainer{&container{RawName: "cache", RawImage: "redis", RawPull: "always"}, "3", "i3", false, true, false, false},
+		&PlannedContainer{&container{RawName: "web", RawImage: "nginx", RawPull: "missing"}, "", "", false, false, false, false},
+	}
+	orphans := Containers{&PlannedContainer{&container{RawName: "old"}, "4", "", false, false, false, false}}
+	return containers, orphans
+}
+
+func TestNewPlan(t *testing.T) {
+	os.Clearenv()
+	containers, orphans := plannedContainers()
+	plan := newPlan(plannedConfig(containers, orphans), containers, orphans)
+	expected := []string{"remove old", "build app", "recreate app", "pull cache", "start cache", "pull web", "create web"}
+	if len(plan.Actions) != len(expected) {
+		t.Fatalf("Plan should have had %d actions, got %v", len(expected), plan.Actions)
+	}
+	for i, action := range plan.Actions {
+		if action.Kind+" "+action.Container != expected[i] {
+			t.Errorf("Action %d should have been %s, got %s %s", i, expected[i], action.Kind, action.Container)
+		}
+	}
+	if action := plan.Actions[2]; action.ContainerId != "2" {
+		t.Errorf("Recreate action should have recorded the container id, got %v", action)
+	}
+	if len(plan.Definitions) != 4 || len(plan.Definitions["db"]) == 0 {
+		t.Errorf("Plan should have recorded the definitions of all containers, got %v", plan.Definitions)
+	}
+	var out bytes.Buffer
+	plan.display(&out)
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 10 || !strings.HasPrefix(lines[0], "- old") || !strings.HasPrefix(lines[2], "~ app") || lines[3] != "    image:" || lines[4] != "      - app" || lines[5] != "      + app:old" || !strings.HasPrefix(lines[9], "+ web") {
+		t.Errorf("Plan should have been displayed with one line per action, got %q", out.String())
+	}
+	out.Reset()
+	newPlan(plannedConfig(containers, nil), containers[:1], nil).display(&out)
+	if !strings.Contains(out.String(), "Nothing to do") {
+		t.Errorf("Empty plan should have been displayed as such, got %q", out.String())
+	}
+}
+
+func TestPlanUnknownDefinition(t *testing.T) {
+	os.Clearenv()
+	containers := Containers{
+		&PlannedContainer{&container{RawName: "db", RawImage: "mysql", RawPull: "never"}, "1", "i1", true, true, false, true},
+		&PlannedContainer{&container{RawName: "web", RawImage: "nginx", RawPull: "never"}, "2", "i2", false, true, false, true},
+	}
+	plan := newPlan(plannedConfig(containers, nil), containers, nil)
+	expected := []string{"unknown db", "unknown web", "start web"}
+	if len(plan.Actions) != len(expected) {
+		t.Fatalf("Plan should have had %d actions, got %v", len(expected), plan.Actions)
+	}
+	for i, action := range plan.Actions {
+		if action.Kind+" "+action.Container != expected[i] {
+			t.Errorf("Action %d should have been %s, got %s %s", i, expected[i], action.Kind, action.Container)
+		}
+	}
+}
+
+func TestPlanLinkDependents(t *testing.T) {
+	os.Clearenv()
+	containers := Containers{
+		&PlannedContainer{&container{RawName: "app", RawImage: "app", RawPull: "never"}, "1", "i1", true, true, true, false},
+		&PlannedContainer{&container{RawName: "web", RawImage: "nginx", RawPull: "never", RunParams: RunParameters{RawLink: []string{"app:app"}}}, "2", "i2", true, true, false, false},
+	}
+	proxy := &PlannedContainer{&container{RawName: "proxy", RawImage: "nginx", RawPull: "never", RunParams: RunParameters{RawLink: []string{"web:web"}}}, "3", "i2", true, true, true, false}
+	config := plannedConfig(append(containers, proxy), nil)
+	plan := newPlan(config, containers, nil)
+	expected := []string{"recreate app", "recreate web", "recreate proxy"}
+	if len(plan.Actions) != len(expected) {
+		t.Fatalf("Plan should have had %d actions, got %v", len(expected), plan.Actions)
+	}
+	for i, action := range plan.Actions {
+		if action.Kind+" "+action.Container != expected[i] {
+			t.Errorf("Action %d should have been %s, got %s %s", i, expected[i], action.Kind, action.Container)
+		}
+	}
+	if plan.Actions[1].Reason != "links to app" || len(plan.Actions[2].Changes) != 1 || len(plan.Definitions["proxy"]) == 0 {
+		t.Errorf("Recreations of the dependents should have been explained and recorded, got %v", plan.Actions)
+	}
+}
+
+func TestSavedPlan(t *testing.T) {
+	os.Clearenv()
+	dir, err := ioutil.TempDir("", "crane-plan")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "plan.json")
+	containers, orphans := plannedContainers()
+	config := plannedConfig(containers, orphans)
+	newPlan(config, containers, orphans).save(filename)
+
+	plan := readPlan(filename)
+	if err := plan.resolve(config); err != nil {
+		t.Errorf("Unchanged environment should have been accepted, got %s", err)
+	}
+	for _, action := range plan.Actions {
+		if action.container == nil {
+			t.Errorf("Container of action %s %s should have been resolved", action.Kind, action.Container)
+		}
+	}
+
+	// changed container, image and definitions (also of a container
+	// without actions), and a removed orphan
+	containers[0].(*PlannedContainer).Container.(*container).RunParams.RawEnv = []string{"A=B"}
+	containers[1].(*PlannedContainer).id = "5"
+	containers[2].(*PlannedContainer).imageId = "i6"
+	containers[3].(*PlannedContainer).Container.(*container).RawImage = "nginx:1.9"
+	config.orphans = nil
+	plan = readPlan(filename)
+	err = plan.resolve(config)
+	if err == nil {
+		t.Fatalf("Changed environment should have been refused")
+	}
+	for _, change := range []string{"container old cannot be found", "container app was changed", "image of container cache", "definition of container db", "definition of container web"} {
+		if !strings.Contains(err.Error(), change) {
+			t.Errorf("Error should have mentioned %q, got %s", change, err)
+		}
+	}
+}
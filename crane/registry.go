@@ -0,0 +1,87 @@
+package crane
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+const defaultRegistry = "https://index.docker.io/v1/"
+
+// RegistryCredentials holds the credentials
+// needed to authenticate against a registry
+type RegistryCredentials struct {
+	Username string
+	Password string
+}
+
+// registries we already logged in during this invocation
+var loggedInRegistries = make(map[string]bool)
+
+// imageRegistry returns the registry of the given image
+// reference, defaulting to the Docker Hub
+func imageRegistry(image string) string {
+	parts := strings.SplitN(image, "/", 2)
+	if len(parts) == 2 && (strings.ContainsAny(parts[0], ".:") || parts[0] == "localhost") {
+		return parts[0]
+	}
+	return defaultRegistry
+}
+
+// imageRepository strips the tag (if any)
+// from the given image reference
+func imageRepository(image string) string {
+	if i := strings.LastIndex(image, ":"); i > strings.LastIndex(image, "/") {
+		return image[:i]
+	}
+	return image
+}
+
+// registryCredentials looks up the credentials for the given registry
+// in the CRANE_REGISTRY_USERNAME and CRANE_REGISTRY_PASSWORD environment
+// variables, optionally restricted to the registry given in CRANE_REGISTRY.
+// The credentials stored in ~/.docker/config.json by `docker login` are
+// used by the docker CLI directly.
+func registryCredentials(registry string) (credentials RegistryCredentials, ok bool) {
+	username, password := os.Getenv("CRANE_REGISTRY_USERNAME"), os.Getenv("CRANE_REGISTRY_PASSWORD")
+	if len(username) == 0 || len(password) == 0 {
+		return
+	}
+	if server := os.Getenv("CRANE_REGISTRY"); len(server) > 0 && server != registry {
+		return
+	}
+	return RegistryCredentials{username, password}, true
+}
+
+// login authenticates against the registry of the given image
+// if credentials are provided via the environment. This requires
+// Docker 17.07 or later, for `docker login --password-stdin`.
+func login(image string) {
+	registry := imageRegistry(image)
+	if loggedInRegistries[registry] {
+		return
+	}
+	loggedInRegistries[registry] = true
+	credentials, ok := registryCredentials(registry)
+	if !ok {
+		return
+	}
+	fmt.Printf("Logging in to %s as %s ... ", registry, credentials.Username)
+	// pass the password via stdin so that it never shows up in the
+	// verbose output or the process list
+	args := []string{"login", "--username", credentials.Username, "--password-stdin"}
+	if registry != defaultRegistry {
+		args = append(args, registry)
+	}
+	if isVerbose() {
+		fmt.Printf("\n--> docker %s\n", strings.Join(args, " "))
+	}
+	cmd := exec.Command("docker", args...)
+	cmd.Stdin = strings.NewReader(credentials.Password)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		panic(StatusError{fmt.Errorf("Could not log in to %s: %s", registry, err), 1})
+	}
+}
@@ -0,0 +1,49 @@
+package crane
+
+import (
+	"os"
+	"testing"
+)
+
+func TestImageRegistry(t *testing.T) {
+	examples := map[string]string{
+		"ubuntu":                      defaultRegistry,
+		"michaelsauter/apache":        defaultRegistry,
+		"localhost/app":               "localhost",
+		"localhost:5000/app:1.0":      "localhost:5000",
+		"registry.example.com/a/b:v2": "registry.example.com",
+	}
+	for image, expected := range examples {
+		if registry := imageRegistry(image); registry != expected {
+			t.Errorf("Registry of %s should have been %s, got %s", image, expected, registry)
+		}
+	}
+}
+
+func TestImageRepository(t *testing.T) {
+	examples := map[string]string{
+		"ubuntu":                 "ubuntu",
+		"ubuntu:14.04":           "ubuntu",
+		"localhost:5000/app":     "localhost:5000/app",
+		"localhost:5000/app:1.0": "localhost:5000/app",
+	}
+	for image, expected := range examples {
+		if repository := imageRepository(image); repository != expected {
+			t.Errorf("Repository of %s should have been %s, got %s", image, expected, repository)
+		}
+	}
+}
+
+func TestRegistryCredentialsFromEnv(t *testing.T) {
+	os.Clearenv()
+	os.Setenv("CRANE_REGISTRY_USERNAME", "user")
+	os.Setenv("CRANE_REGISTRY_PASSWORD", "secret")
+	credentials, ok := registryCredentials("localhost:5000")
+	if !ok || credentials.Username != "user" || credentials.Password != "secret" {
+		t.Errorf("Credentials should have been read from the environment, got %v", credentials)
+	}
+	os.Setenv("CRANE_REGISTRY", "registry.example.com")
+	if _, ok := registryCredentials("localhost:5000"); ok {
+		t.Errorf("Credentials should have been restricted to registry.example.com")
+	}
+}
@@ -0,0 +1,93 @@
+package crane
+
+import (
+	"fmt"
+	"os"
+)
+
+// resource holds what networks and volumes have in common:
+// crane creates them with their driver and options, labelled
+// with the config, and removes them once no container uses
+// them anymore
+type resource struct {
+	RawName    string
+	RawDriver  string   `json:"driver" yaml:"driver"`
+	RawOptions []string `json:"options" yaml:"options"`
+	labels     []string
+}
+
+func (r *resource) Name() string {
+	return os.ExpandEnv(r.RawName)
+}
+
+func (r *resource) Driver() string {
+	return os.ExpandEnv(r.RawDriver)
+}
+
+func (r *resource) Options() []string {
+	var options []string
+	for _, rawOption := range r.RawOptions {
+		options = append(options, os.ExpandEnv(rawOption))
+	}
+	return options
+}
+
+// exists checks whether the resource of the given kind
+// (network or volume) exists
+func (r *resource) exists(kind string) bool {
+	_, err := commandOutput("docker", []string{kind, "inspect", r.Name()})
+	return err == nil
+}
+
+// create the resource of the given kind unless it already
+// exists, passing its name with the given arguments
+func (r *resource) create(kind string, nameArgs []string) {
+	if r.exists(kind) {
+		return
+	}
+	fmt.Printf("Creating %s %s ... ", kind, r.Name())
+	args := []string{kind, "create"}
+	if len(r.Driver()) > 0 {
+		args = append(args, "--driver", r.Driver())
+	}
+	for _, option := range r.Options() {
+		args = append(args, "--opt", option)
+	}
+	for _, label := range r.labels {
+		args = append(args, "--label", label)
+	}
+	args = append(args, nameArgs...)
+	executeCommand("docker", args)
+}
+
+// rm removes the resource of the given kind if it was created
+// by crane for this config, unless containers (running or not)
+// still use it, which would fail to start without it
+func (r *resource) rm(kind string) {
+	if !r.exists(kind) {
+		return
+	}
+	if !Target(r.labels).includes(configLabel + "=" + inspectResource(kind, r.Name(), "{{index .Labels \""+configLabel+"\"}}")) {
+		fmt.Printf("Keeping %s %s as it was not created by crane for this config.\n", kind, r.Name())
+		return
+	}
+	users, _ := commandOutput("docker", []string{"ps", "--all", "--quiet", "--filter", kind + "=" + r.Name()})
+	if len(users) > 0 {
+		fmt.Printf("Keeping %s %s as containers still use it.\n", kind, r.Name())
+		return
+	}
+	fmt.Printf("Removing %s %s ... ", kind, r.Name())
+	executeCommand("docker", []string{kind, "rm", r.Name()})
+}
+
+// Returns the value referenced by the go template for
+// the `docker <kind> inspect` as a string, fallbacking
+// to an empty string on error
+func inspectResource(kind string, name string, format string) string {
+	args := []string{kind, "inspect", "--format=" + format, name}
+	output, err := commandOutput("docker", args)
+	if err != nil {
+		return ""
+	}
+	return output
+}
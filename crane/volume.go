@@ -0,0 +1,51 @@
+package crane
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+)
+
+// VolumeMap maps the volume name
+// to its configuration
+type VolumeMap map[string]*volume
+
+type volume struct {
+	resource `yaml:",inline"`
+}
+
+func (v *volume) Exists() bool {
+	return v.exists("volume")
+}
+
+// Create the volume unless it already exists
+func (v *volume) Create() {
+	v.create("volume", []string{"--name", v.Name()})
+}
+
+// Remove the volume if it was created by crane for
+// this config, unless containers still use it
+func (v *volume) Rm() {
+	v.rm("volume")
+}
+
+// Status of the given volumes.
+func (volumes VolumeMap) status(names []string) {
+	if len(names) == 0 {
+		return
+	}
+	w := new(tabwriter.Writer)
+	w.Init(os.Stdout, 0, 8, 1, '\t', 0)
+	fmt.Fprintln(w, "\nVOLUME\tDRIVER\tEXISTS")
+	for _, name := range names {
+		if v, ok := volumes[name]; ok {
+			driver := v.Driver()
+			if len(driver) == 0 {
+				driver = "local"
+			}
+			fmt.Fprintf(w, "%s\n", strings.Join([]string{v.Name(), driver, fmt.Sprint(v.Exists())}, "\t"))
+		}
+	}
+	w.Flush()
+}
@@ -0,0 +1,124 @@
+package crane
+
+import (
+	"fmt"
+	"github.com/michaelsauter/crane/print"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// interval between two scans of the watched paths
+const watchInterval = 500 * time.Millisecond
+
+// snapshot maps the files below the watched
+// paths to their modification time and size
+type snapshot map[string]string
+
+// takeSnapshot walks the given paths, skipping .git directories
+// and ignoring the paths which do not exist
+func takeSnapshot(paths []string) snapshot {
+	s := make(snapshot)
+	for _, root := range paths {
+		filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return nil
+			}
+			if info.IsDir() {
+				if info.Name() == ".git" {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			s[path] = fmt.Sprintf("%d/%d", info.ModTime().UnixNano(), info.Size())
+			return nil
+		})
+	}
+	return s
+}
+
+// changes returns the files which were added, modified
+// or deleted since the other snapshot, sorted
+func (s snapshot) changes(other snapshot) []string {
+	changed := []string{}
+	for path, state := range s {
+		if other[path] != state {
+			changed = append(changed, path)
+		}
+	}
+	for path := range other {
+		if _, ok := s[path]; !ok {
+			changed = append(changed, path)
+		}
+	}
+	sort.Strings(changed)
+	return changed
+}
+
+// watch scans the build context and the watch paths of the targeted
+// containers. Once the changes to a container settled for the debounce
+// duration, its image is rebuilt and the container is recreated along
+// with the containers affected by it.
+func watch(config Config, debounce time.Duration, timeout int) {
+	containers := config.TargetedContainers()
+	snapshots := make(map[string]snapshot)
+	for _, container := range containers {
+		paths := container.WatchPaths()
+		if len(paths) == 0 {
+			continue
+		}
+		snapshots[container.Name()] = takeSnapshot(paths)
+		print.Infof("Watching %s for container %s\n", strings.Join(paths, ", "), container.Name())
+	}
+	if len(snapshots) == 0 {
+		print.Errorf("ERROR: None of the containers has a build context or watch paths.\n")
+		return
+	}
+	pending := make(map[string]time.Time)
+	for {
+		time.Sleep(watchInterval)
+		for _, container := range containers {
+			previous, ok := snapshots[container.Name()]
+			if !ok {
+				continue
+			}
+			current := takeSnapshot(container.WatchPaths())
+			if changed := current.changes(previous); len(changed) > 0 {
+				if isVerbose() {
+					fmt.Printf("Changed for container %s: %s\n", container.Name(), strings.Join(changed, ", "))
+				}
+				snapshots[container.Name()] = current
+				pending[container.Name()] = time.Now()
+			}
+		}
+		for _, container := range containers {
+			if changedAt, ok := pending[container.Name()]; ok && time.Since(changedAt) >= debounce {
+				delete(pending, container.Name())
+				recreateAfterChange(config, container, timeout)
+			}
+		}
+	}
+}
+
+// recreateAfterChange rebuilds the image of the container and recreates it
+// along with the containers affected by it. Errors are displayed only, so
+// that watching goes on.
+func recreateAfterChange(config Config, container Container, timeout int) {
+	defer func() {
+		if err := recover(); err != nil {
+			if statusError, ok := err.(StatusError); ok && statusError.error != nil {
+				err = statusError.error
+			}
+			print.Errorf("ERROR: %v\n", err)
+		}
+	}()
+	print.Noticef("Change detected for container %s.\n", container.Name())
+	if len(container.Dockerfile()) > 0 {
+		container.Provision(false)
+	}
+	affected := affectedContainers(config, container.Name(), "all")
+	affected.reversed().rm(true, timeout)
+	affected.run(false, timeout)
+}
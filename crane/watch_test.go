@@ -0,0 +1,53 @@
+package crane
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestSnapshotChanges(t *testing.T) {
+	dir, err := ioutil.TempDir("", "crane-watch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	ioutil.WriteFile(filepath.Join(dir, "a"), []byte("a"), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "b"), []byte("b"), 0644)
+	os.MkdirAll(filepath.Join(dir, ".git"), 0755)
+	ioutil.WriteFile(filepath.Join(dir, ".git", "HEAD"), []byte("x"), 0644)
+	before := takeSnapshot([]string{dir, filepath.Join(dir, "missing")})
+	if len(before) != 2 {
+		t.Errorf("Snapshot should have contained a and b, got %v", before)
+	}
+	ioutil.WriteFile(filepath.Join(dir, "a"), []byte("aa"), 0644)
+	os.Remove(filepath.Join(dir, "b"))
+	ioutil.WriteFile(filepath.Join(dir, "c"), []byte("c"), 0644)
+	ioutil.WriteFile(filepath.Join(dir, ".git", "HEAD"), []byte("y"), 0644)
+	after := takeSnapshot([]string{dir})
+	expected := []string{filepath.Join(dir, "a"), filepath.Join(dir, "b"), filepath.Join(dir, "c")}
+	if changes := after.changes(before); !reflect.DeepEqual(changes, expected) {
+		t.Errorf("Changes should have been %v, got %v", expected, changes)
+	}
+	if changes := after.changes(after); len(changes) != 0 {
+		t.Errorf("There should have been no changes, got %v", changes)
+	}
+}
+
+func TestAffectedContainers(t *testing.T) {
+	c := &config{containerMap: NewStubbedContainerMap(true,
+		&container{RawName: "db"},
+		&container{RawName: "app", RunParams: RunParameters{RawLink: []string{"db:db"}}},
+		&container{RawName: "web", RunParams: RunParameters{RawLink: []string{"app:app", "db:db"}}},
+		&container{RawName: "migrate", RawKind: "task", RunParams: RunParameters{RawLink: []string{"db:db"}}},
+		&container{RawName: "cache"},
+	)}
+	if names := affectedContainers(c, "db", "all").names(); !reflect.DeepEqual(names, []string{"db", "app", "web"}) {
+		t.Errorf("Affected containers should have been db, app and web, got %v", names)
+	}
+	if names := affectedContainers(c, "cache", "all").names(); !reflect.DeepEqual(names, []string{"cache"}) {
+		t.Errorf("Affected containers should have been cache only, got %v", names)
+	}
+}